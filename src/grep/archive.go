@@ -0,0 +1,101 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"strings"
+
+	"grep/grep"
+)
+
+const (
+	archiveTar   = "tar"
+	archiveTarGz = "tar.gz"
+	archiveZip   = "zip"
+)
+
+// archiveSep separates the archive name from the member name in output
+const archiveSep = "!"
+
+// archiveKind returns the kind of archive fname is by its extension, or an
+// empty string if it is not an archive grep-go can look inside.
+func archiveKind(fname string) string {
+	lower := strings.ToLower(fname)
+	switch {
+	case strings.HasSuffix(lower, ".tar"):
+		return archiveTar
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return archiveTarGz
+	case strings.HasSuffix(lower, ".zip"):
+		return archiveZip
+	}
+	return ""
+}
+
+// searchArchive searches every regular file inside the archive as if it were
+// a file of its own named "archive!path/inside/file"
+func searchArchive(ctx context.Context, file *os.File, kind string, searcher *grep.Searcher) error {
+	switch kind {
+	case archiveTarGz:
+		zr, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		return searchTar(ctx, zr, file.Name(), searcher)
+	case archiveTar:
+		return searchTar(ctx, file, file.Name(), searcher)
+	case archiveZip:
+		info, err := file.Stat()
+		if err != nil {
+			return err
+		}
+		return searchZip(ctx, file, info.Size(), file.Name(), searcher)
+	}
+	return nil
+}
+
+func searchTar(ctx context.Context, r io.Reader, fname string, searcher *grep.Searcher) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !hdr.FileInfo().Mode().IsRegular() {
+			continue
+		}
+		if err := searchReader(ctx, tr, fname+archiveSep+hdr.Name, searcher); err != nil {
+			return err
+		}
+	}
+}
+
+func searchZip(ctx context.Context, r io.ReaderAt, size int64, fname string, searcher *grep.Searcher) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return err
+	}
+	for _, f := range zr.File {
+		if !f.Mode().IsRegular() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		err = searchReader(ctx, rc, fname+archiveSep+f.Name, searcher)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"code.google.com/p/getopt"
+)
+
+// configEnv names a config file to read instead of the default one
+const configEnv = "GREPGO_CONFIG_PATH"
+
+// configPath returns the config file to read, or "" if there is none
+func configPath() string {
+	if path := os.Getenv(configEnv); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "grep-go", "config")
+}
+
+// parseConfig sets the flags in the config file, before the ones on the
+// command line are parsed so that those win. Each line holds one flag, with
+// any value joined on by "=" or after whitespace, and blank lines and lines starting with # are
+// skipped. A missing file is the same as an empty one. A bad flag is reported
+// with the line it is on and ends grep-go.
+func parseConfig() {
+	path := configPath()
+	if path == "" {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			fmt.Fprintln(os.Stderr, "warning:", err.Error())
+		}
+		return
+	}
+
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		// a value may follow the flag after whitespace, as on the command
+		// line, so the line is split at the first run of it unless the value
+		// is already joined on with "="
+		args := []string{os.Args[0], line}
+		if i := strings.IndexFunc(line, unicode.IsSpace); i >= 0 && !strings.Contains(line[:i], "=") {
+			args = []string{os.Args[0], line[:i], strings.TrimSpace(line[i:])}
+		}
+		// each line is parsed on its own so errors can say where they are
+		err := getopt.CommandLine.Getopt(args, nil)
+		if err == nil && (!strings.HasPrefix(line, "-") || len(getopt.Args()) > 0) {
+			err = errors.New("not a flag: " + line)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s:%d: %s\n", path, i+1, err.Error())
+			os.Exit(2)
+		}
+	}
+}
+
+// noConfig reports whether --no-config is among args. It has to be known
+// before the flags are parsed.
+func noConfig(args []string) bool {
+	for _, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if arg == "--no-config" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,12 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package main
+
+import "os"
+
+// deviceID doesn't know the device of files here, so --one-file-system
+// descends into every directory
+func deviceID(info os.FileInfo) (uint64, bool) {
+	return 0, false
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"time"
+)
+
+// followInterval is how often a followed file is checked for new data
+const followInterval = 250 * time.Millisecond
+
+// followReader reads a file like tail -F. At the end of the file it waits for
+// more to be written instead of returning io.EOF. If the file is truncated it
+// starts again from the top, and if the name now refers to a different file,
+// as after log rotation, it switches to that file once the old one has been
+// read to the end.
+type followReader struct {
+	ctx    context.Context
+	name   string
+	file   *os.File
+	offset int64
+}
+
+// newFollowReader follows file until ctx is done, when Read returns the
+// error of ctx
+func newFollowReader(ctx context.Context, file *os.File) *followReader {
+	return &followReader{ctx: ctx, name: file.Name(), file: file}
+}
+
+func (fr *followReader) Read(p []byte) (int, error) {
+	for {
+		n, err := fr.file.Read(p)
+		fr.offset += int64(n)
+		if n > 0 {
+			return n, nil
+		}
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+
+		if fr.rotated() {
+			if file, err := os.Open(fr.name); err == nil {
+				fr.file.Close()
+				fr.file, fr.offset = file, 0
+				continue
+			}
+		}
+		if info, err := fr.file.Stat(); err == nil && info.Size() < fr.offset {
+			// truncated in place, eg by copytruncate
+			if _, err := fr.file.Seek(0, io.SeekStart); err == nil {
+				fr.offset = 0
+				continue
+			}
+		}
+		select {
+		case <-time.After(followInterval):
+		case <-fr.ctx.Done():
+			return 0, fr.ctx.Err()
+		}
+	}
+}
+
+// Close closes the file being read, which is a new one after rotation
+func (fr *followReader) Close() error {
+	return fr.file.Close()
+}
+
+// rotated reports whether the name now refers to a different file, comparing
+// device and inode numbers. A missing name means the new file hasn't been
+// created yet.
+func (fr *followReader) rotated() bool {
+	current, err := fr.file.Stat()
+	if err != nil {
+		return false
+	}
+	named, err := os.Stat(fr.name)
+	if err != nil {
+		return false
+	}
+	return !os.SameFile(current, named)
+}
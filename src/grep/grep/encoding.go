@@ -0,0 +1,133 @@
+package grep
+
+import (
+	"bufio"
+	"bytes"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Encodings of the input. With EncodingAuto a byte order mark at the start
+// of the input decides, falling back to UTF-8 when there is none.
+const (
+	EncodingAuto    = "auto"
+	EncodingUTF8    = "utf-8"
+	EncodingUTF16LE = "utf-16le"
+	EncodingUTF16BE = "utf-16be"
+	EncodingLatin1  = "latin1"
+)
+
+// Encodings are the accepted values of Options.Encoding
+var Encodings = []string{EncodingAuto, EncodingUTF8, EncodingUTF16LE, EncodingUTF16BE, EncodingLatin1}
+
+// bom is the byte order mark once it has been decoded to UTF-8
+const bom = "\uFEFF"
+
+var (
+	bomUTF16LE = []byte{0xff, 0xfe}
+	bomUTF16BE = []byte{0xfe, 0xff}
+)
+
+// lineDecoder splits raw input into lines and converts each line to UTF-8.
+// Lines are returned undecoded, terminator included, so callers can keep
+// track of offsets in the original input.
+type lineDecoder struct {
+	encoding string
+}
+
+// newLineDecoder returns a decoder for enc. For EncodingAuto the byte order mark
+// at the start of r decides, falling back to UTF-8 when there is none.
+func newLineDecoder(enc string, r *bufio.Reader) *lineDecoder {
+	if enc != EncodingAuto {
+		return &lineDecoder{encoding: enc}
+	}
+	head, _ := r.Peek(3)
+	switch {
+	case bytes.HasPrefix(head, bomUTF16LE):
+		return &lineDecoder{encoding: EncodingUTF16LE}
+	case bytes.HasPrefix(head, bomUTF16BE):
+		return &lineDecoder{encoding: EncodingUTF16BE}
+	}
+	return &lineDecoder{encoding: EncodingUTF8}
+}
+
+// readLine reads the next line from r including its terminator. In UTF-16 a
+// newline is a whole code unit so a 0x0a byte that is half of some other
+// character does not end the line.
+func (d *lineDecoder) readLine(r *bufio.Reader) ([]byte, error) {
+	var line []byte
+	for {
+		chunk, err := r.ReadBytes('\n')
+		line = append(line, chunk...)
+		if err != nil {
+			return line, err
+		}
+
+		switch d.encoding {
+		case EncodingUTF16LE:
+			// the newline must start a code unit and be followed by 0x00
+			if len(line)%2 == 1 {
+				if next, err := r.Peek(1); err == nil && next[0] == 0 {
+					r.ReadByte()
+					return append(line, 0), nil
+				}
+			}
+		case EncodingUTF16BE:
+			// the newline must end a code unit that starts with 0x00
+			if len(line)%2 == 0 && line[len(line)-2] == 0 {
+				return line, nil
+			}
+		default:
+			return line, nil
+		}
+	}
+}
+
+// decode converts a raw line to UTF-8, dropping the line terminator
+func (d *lineDecoder) decode(raw []byte) string {
+	switch d.encoding {
+	case EncodingUTF16LE, EncodingUTF16BE:
+		return decodeUTF16(raw, d.encoding == EncodingUTF16BE)
+	case EncodingLatin1:
+		return decodeLatin1(trimEOL(raw))
+	}
+	return string(trimEOL(raw))
+}
+
+func trimEOL(raw []byte) []byte {
+	raw = bytes.TrimSuffix(raw, []byte("\n"))
+	return bytes.TrimSuffix(raw, []byte("\r"))
+}
+
+func decodeUTF16(raw []byte, bigEndian bool) string {
+	units := make([]uint16, 0, len(raw)/2)
+	for i := 0; i+1 < len(raw); i += 2 {
+		if bigEndian {
+			units = append(units, uint16(raw[i])<<8|uint16(raw[i+1]))
+		} else {
+			units = append(units, uint16(raw[i+1])<<8|uint16(raw[i]))
+		}
+	}
+	if n := len(units); n > 0 && units[n-1] == '\n' {
+		units = units[:n-1]
+	}
+	if n := len(units); n > 0 && units[n-1] == '\r' {
+		units = units[:n-1]
+	}
+
+	text := string(utf16.Decode(units))
+	if len(raw)%2 == 1 {
+		// a dangling half of a code unit at the end of the input
+		text += string(utf8.RuneError)
+	}
+	return text
+}
+
+// decodeLatin1 maps every byte to the code point of the same value
+func decodeLatin1(raw []byte) string {
+	buf := make([]byte, 0, len(raw))
+	for _, b := range raw {
+		buf = utf8.AppendRune(buf, rune(b))
+	}
+	return string(buf)
+}
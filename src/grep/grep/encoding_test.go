@@ -0,0 +1,73 @@
+package grep
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+	"unicode/utf16"
+)
+
+// encodeUTF16 is the UTF-16 of s, big endian if be is set
+func encodeUTF16(s string, be bool) []byte {
+	var out []byte
+	for _, u := range utf16.Encode([]rune(s)) {
+		if be {
+			out = append(out, byte(u>>8), byte(u))
+		} else {
+			out = append(out, byte(u), byte(u>>8))
+		}
+	}
+	return out
+}
+
+var lineDecoderTests = []struct {
+	name  string
+	enc   string
+	input []byte
+	lines []string
+}{
+	{"utf-8", EncodingAuto, []byte("one\ntwo\r\nthree"), []string{"one", "two", "three"}},
+	{"latin1", EncodingLatin1, []byte("caf\xe9\nna\xefve\n"), []string{"café", "naïve"}},
+	{"utf-16le with bom", EncodingAuto, append([]byte{0xff, 0xfe}, encodeUTF16("one\r\ntwo\n", false)...), []string{bom + "one", "two"}},
+	{"utf-16be with bom", EncodingAuto, append([]byte{0xfe, 0xff}, encodeUTF16("one\ntwo", true)...), []string{bom + "one", "two"}},
+	// U+0A0A is 0x0a 0x0a in either byte order but doesn't end a line, and
+	// neither does the 0x0a in U+0D0A or U+0A0D
+	{"utf-16le newline bytes", EncodingUTF16LE, encodeUTF16("a\u0a0ab\nc", false), []string{"a\u0a0ab", "c"}},
+	{"utf-16be newline bytes", EncodingUTF16BE, encodeUTF16("a\u0a0ab\nc", true), []string{"a\u0a0ab", "c"}},
+	{"utf-16le U+0D0A", EncodingUTF16LE, encodeUTF16("\u0d0a\n", false), []string{"\u0d0a"}},
+	{"utf-16be U+0A0D", EncodingUTF16BE, encodeUTF16("\u0a0d\n", true), []string{"\u0a0d"}},
+	{"utf-16le surrogates", EncodingUTF16LE, encodeUTF16("😀\nx", false), []string{"😀", "x"}},
+	{"utf-16le dangling byte", EncodingUTF16LE, append(encodeUTF16("ab", false), 'c'), []string{"ab\ufffd"}},
+}
+
+func TestLineDecoder(t *testing.T) {
+	for _, tt := range lineDecoderTests {
+		r := bufio.NewReader(bytes.NewReader(tt.input))
+		dec := newLineDecoder(tt.enc, r)
+
+		var lines []string
+		var total int
+		for {
+			raw, err := dec.readLine(r)
+			total += len(raw)
+			if len(raw) > 0 {
+				lines = append(lines, dec.decode(raw))
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+		}
+		if !reflect.DeepEqual(lines, tt.lines) {
+			t.Errorf("%s: got %q, want %q", tt.name, lines, tt.lines)
+		}
+		// every byte is in some line so offsets add up
+		if total != len(tt.input) {
+			t.Errorf("%s: lines hold %d bytes, want %d", tt.name, total, len(tt.input))
+		}
+	}
+}
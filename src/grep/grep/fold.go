@@ -0,0 +1,85 @@
+package grep
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// indexFold returns the byte range of the first match of the pattern runes in
+// s when case is ignored, or -1, -1. Runes are compared with Unicode simple case
+// folding, so the Kelvin sign matches k and final sigma matches Σ, and the
+// matched text can be a different length from pattern.
+func indexFold(s string, runes []rune) (int, int) {
+	for i := 0; i < len(s); {
+		end, ok := i, true
+		for _, pr := range runes {
+			if end >= len(s) {
+				return -1, -1
+			}
+			r, size := utf8.DecodeRuneInString(s[end:])
+			if !equalFold(r, pr) {
+				ok = false
+				break
+			}
+			end += size
+		}
+		if ok {
+			return i, end
+		}
+		_, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+	}
+	return -1, -1
+}
+
+// equalFold reports whether a and b are the same under simple case folding
+func equalFold(a, b rune) bool {
+	if a == b {
+		return true
+	}
+	if a < utf8.RuneSelf && b < utf8.RuneSelf {
+		if 'A' <= a && a <= 'Z' {
+			a += 'a' - 'A'
+		}
+		if 'A' <= b && b <= 'Z' {
+			b += 'a' - 'A'
+		}
+		return a == b
+	}
+	// SimpleFold walks the orbit of runes that fold together, eg k, K and
+	// the Kelvin sign, until it comes back round to a
+	for r := unicode.SimpleFold(a); r != a; r = unicode.SimpleFold(r) {
+		if r == b {
+			return true
+		}
+	}
+	return false
+}
+
+// hasUpper reports whether pattern has an uppercase letter for SmartCase.
+// Escapes in a regexp such as \W or \p{Lu} name classes rather than letters to match, so
+// they are skipped.
+func hasUpper(pattern string, regex bool) bool {
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		if regex && c == '\\' && i+1 < len(pattern) {
+			i++
+			if (pattern[i] == 'p' || pattern[i] == 'P') && i+1 < len(pattern) && pattern[i+1] == '{' {
+				for i < len(pattern) && pattern[i] != '}' {
+					i++
+				}
+			}
+			continue
+		}
+		if c >= utf8.RuneSelf {
+			r, size := utf8.DecodeRuneInString(pattern[i:])
+			if unicode.IsUpper(r) {
+				return true
+			}
+			i += size - 1
+		} else if 'A' <= c && c <= 'Z' {
+			return true
+		}
+	}
+	return false
+}
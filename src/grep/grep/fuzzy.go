@@ -0,0 +1,165 @@
+package grep
+
+import (
+	"errors"
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+)
+
+// fuzzyMaxLen is the longest pattern that fits in the bit vectors of the
+// fuzzy matcher
+const fuzzyMaxLen = 64
+
+// fuzzyMatcher finds approximate matches of a fixed pattern with the
+// bit-parallel algorithm of Wu and Manber, which runs in linear time for
+// patterns up to fuzzyMaxLen runes.
+type fuzzyMatcher struct {
+	pattern []rune
+	// k is the number of errors allowed in a match
+	k          int
+	ignoreCase bool
+	// masks have bit i set for each rune that may stand at pattern[i]
+	ascii [utf8.RuneSelf]uint64
+	masks map[rune]uint64
+}
+
+// checkFuzzy reports why pattern can't be searched with opts.Fuzzy
+func checkFuzzy(pattern string, opts Options) error {
+	switch n := utf8.RuneCountInString(pattern); {
+	case opts.UseRegex:
+		return errors.New("fuzzy matching only works with fixed strings, not regexps")
+	case opts.Multiline || len(opts.Terms) > 0:
+		return errors.New("fuzzy matching can't be used with multiline matching or terms")
+	case n > fuzzyMaxLen:
+		return fmt.Errorf("fuzzy patterns can be at most %d characters", fuzzyMaxLen)
+	case n <= opts.Fuzzy:
+		return errors.New("the fuzzy distance must be less than the length of the pattern")
+	}
+	return nil
+}
+
+func newFuzzyMatcher(pattern string, k int, ignoreCase bool) *fuzzyMatcher {
+	fm := &fuzzyMatcher{pattern: []rune(pattern), k: k, ignoreCase: ignoreCase, masks: map[rune]uint64{}}
+	for i, p := range fm.pattern {
+		fm.setMask(p, i)
+		if ignoreCase {
+			for r := unicode.SimpleFold(p); r != p; r = unicode.SimpleFold(r) {
+				fm.setMask(r, i)
+			}
+		}
+	}
+	return fm
+}
+
+func (fm *fuzzyMatcher) setMask(r rune, i int) {
+	if r < utf8.RuneSelf {
+		fm.ascii[r] |= 1 << uint(i)
+	} else {
+		fm.masks[r] |= 1 << uint(i)
+	}
+}
+
+func (fm *fuzzyMatcher) mask(r rune) uint64 {
+	if r < utf8.RuneSelf {
+		return fm.ascii[r]
+	}
+	return fm.masks[r]
+}
+
+// find returns the best approximate match of the pattern in s within k
+// errors, and its edit distance. The match is empty if there is none.
+func (fm *fuzzyMatcher) find(s string) (string, int) {
+	k := fm.k
+	last := uint64(1) << uint(len(fm.pattern)-1)
+
+	// bit i of r[d] is set when pattern[:i+1] matches the text ending here
+	// with at most d errors
+	r := make([]uint64, k+1)
+	for d := range r {
+		r[d] = 1<<uint(d) - 1
+	}
+
+	best, end := -1, 0
+	for i := 0; i < len(s); {
+		// an invalid byte decodes to RuneError but is only one byte wide
+		c, size := utf8.DecodeRuneInString(s[i:])
+		b := fm.mask(c)
+		prev := r[0]
+		r[0] = (r[0]<<1 | 1) & b
+		for d := 1; d <= k; d++ {
+			old := r[d]
+			// match, substitution, insertion and deletion respectively
+			r[d] = (old<<1|1)&b | prev<<1 | 1 | prev | r[d-1]<<1
+			prev = old
+		}
+		found := -1
+		for d := 0; d <= k; d++ {
+			if r[d]&last != 0 {
+				found = d
+				break
+			}
+		}
+		next := i + size
+		switch {
+		case found >= 0 && (best < 0 || found < best):
+			best, end = found, next
+		case found >= 0 && found == best && end == i:
+			// the best match carries on to this rune too
+			end = next
+		}
+		if best == 0 {
+			break
+		}
+		i = next
+	}
+	if best < 0 {
+		return "", 0
+	}
+	return s[fm.matchStart(s, end, best):end], best
+}
+
+// matchStart finds where the match ending at end begins by aligning the
+// pattern backwards from there. Of the starts that bring its edit distance
+// down to dist it takes the earliest, for the longest match.
+func (fm *fuzzyMatcher) matchStart(s string, end, dist int) int {
+	m := len(fm.pattern)
+	// col[i] is the distance between the last i pattern runes and s[start:end]
+	col := make([]int, m+1)
+	for i := range col {
+		col[i] = i
+	}
+
+	start, best := end, end
+	// the smallest distance in col never goes down again, so once it is over
+	// dist no earlier start can do
+	for low := 0; low <= dist && start > 0; {
+		c, size := utf8.DecodeLastRuneInString(s[:start])
+		start -= size
+
+		diag := col[0]
+		col[0]++
+		low = col[0]
+		for i := 1; i <= m; i++ {
+			cost := 1
+			if p := fm.pattern[m-i]; p == c || (fm.ignoreCase && equalFold(p, c)) {
+				cost = 0
+			}
+			next := diag + cost
+			if col[i]+1 < next {
+				next = col[i] + 1
+			}
+			if col[i-1]+1 < next {
+				next = col[i-1] + 1
+			}
+			diag, col[i] = col[i], next
+			if next < low {
+				low = next
+			}
+		}
+		if col[m] <= dist {
+			best = start
+		}
+	}
+	return best
+}
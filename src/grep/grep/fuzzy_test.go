@@ -0,0 +1,61 @@
+package grep
+
+import "testing"
+
+var fuzzyTests = []struct {
+	pattern    string
+	k          int
+	ignoreCase bool
+	text       string
+	match      string
+	dist       int
+}{
+	{"quick", 1, false, "the quick fox", "quick", 0},
+	{"quick", 1, false, "the quack fox", "quack", 1},
+	{"quick", 1, false, "the qick fox", "qick", 1},
+	{"quick", 1, false, "the quiick fox", "quiick", 1},
+	{"quick", 1, false, "the qiuck fox", "", 0},
+	{"quick", 2, false, "teh qiuck", "qiuck", 2},
+	{"quick", 2, false, "slow", "", 0},
+	// an exact match later on beats an approximate one before it
+	{"quick", 2, false, "quack quick", "quick", 0},
+	{"quick", 1, true, "THE QUICK FOX", "QUICK", 0},
+	{"quick", 1, false, "THE QUICK FOX", "", 0},
+	{"café", 1, false, "a cafe here", "cafe", 1},
+	{"naïve", 1, true, "NAÏVE", "NAÏVE", 0},
+	// an invalid byte is a single substituted character
+	{"abc", 1, false, "ab\xff", "ab\xff", 1},
+	{"abc", 1, false, "x\xffabc", "abc", 0},
+}
+
+func TestFuzzyFind(t *testing.T) {
+	for _, tt := range fuzzyTests {
+		fm := newFuzzyMatcher(tt.pattern, tt.k, tt.ignoreCase)
+		match, dist := fm.find(tt.text)
+		if match != tt.match || dist != tt.dist {
+			t.Errorf("find(%q) for %q with k=%d: got %q at %d, want %q at %d",
+				tt.text, tt.pattern, tt.k, match, dist, tt.match, tt.dist)
+		}
+	}
+}
+
+var checkFuzzyTests = []struct {
+	pattern string
+	opts    Options
+	ok      bool
+}{
+	{"quick", Options{Fuzzy: 2}, true},
+	{"quick", Options{Fuzzy: 2, UseRegex: true}, false},
+	{"quick", Options{Fuzzy: 2, Multiline: true}, false},
+	{"quick", Options{Fuzzy: 2, Terms: []Term{{TermAnd, "fox"}}}, false},
+	{"ab", Options{Fuzzy: 2}, false},
+	{string(make([]byte, fuzzyMaxLen+1)), Options{Fuzzy: 1}, false},
+}
+
+func TestCheckFuzzy(t *testing.T) {
+	for _, tt := range checkFuzzyTests {
+		if err := checkFuzzy(tt.pattern, tt.opts); (err == nil) != tt.ok {
+			t.Errorf("checkFuzzy(%q, %+v) = %v, want ok %v", tt.pattern, tt.opts, err, tt.ok)
+		}
+	}
+}
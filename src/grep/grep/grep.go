@@ -0,0 +1,488 @@
+// Package grep finds the lines of text that match a pattern. It is the search
+// behind the grep-go command: New compiles a pattern and its Options into a
+// Searcher, and Search streams the matches in an input to a callback.
+package grep
+
+import (
+	"bufio"
+	"container/ring"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Options control how a Searcher matches. The zero value matches a fixed
+// string, case sensitively, in UTF-8 text.
+type Options struct {
+	AfterContext int
+	// AllMatch holds back every match until the pattern and each TermAnd and
+	// TermOr term have all matched somewhere in the input
+	AllMatch      bool
+	BeforeContext int
+	// Encoding is one of Encodings. Empty is the same as EncodingAuto.
+	Encoding string
+	// Fuzzy allows up to this many inserted, deleted or substituted
+	// characters in a match of a fixed pattern
+	Fuzzy       int
+	IgnoreCase  bool
+	InvertMatch bool
+	// Multiline lets the pattern match across lines of UTF-8 input
+	Multiline bool
+	// Normalize is one of NormalizationForms, or empty to match text as is
+	Normalize string
+	// SearchZip decompresses input that is gzip, bzip2 or zlib compressed
+	SearchZip bool
+	// SmartCase ignores case unless a pattern has an uppercase letter
+	SmartCase bool
+	Terms     []Term
+	UseRegex  bool
+}
+
+// Line is a line of the input
+type Line struct {
+	Text string
+	Num  int
+	// Offset is the position of the line in the original, undecoded input
+	Offset int64
+	// Distance is the edit distance of a fuzzy match on the line
+	Distance int
+
+	// matched and matchStr are set by readMultilineFile on the lines covered
+	// by a match
+	matched  bool
+	matchStr string
+}
+
+// Match is a matching line from a file. LinesBefore and LinesAfter hold the
+// context asked for, with nil in place of lines beyond the ends of the input.
+type Match struct {
+	Line        *Line
+	MatchStr    string
+	LinesBefore []*Line
+	LinesAfter  []*Line
+}
+
+// Searcher searches input for the lines matching a pattern. It keeps no state
+// between searches, so one Searcher can be used by many goroutines at once.
+type Searcher struct {
+	opts    Options
+	pattern *pattern
+	terms   []term
+	// multiline finds matches across lines for Options.Multiline
+	multiline *regexp.Regexp
+	fuzzy     *fuzzyMatcher
+	// candidates finds possible matches for the buffer scanner when the
+	// pattern has no literal to look for
+	candidates *regexp.Regexp
+}
+
+// pattern is the pattern or a term compiled for matching lines
+type pattern struct {
+	// text is the fixed string, or the source of re
+	text string
+	re   *regexp.Regexp
+	// literal is a string every match contains, or "" if there is none that
+	// a case sensitive substring search can find
+	literal string
+	// runes is text decoded for matching fixed strings ignoring case
+	runes []rune
+}
+
+// term is a Term compiled for matching lines
+type term struct {
+	op      string
+	pattern *pattern
+}
+
+// New returns a Searcher for pattern, or an error if the pattern or the
+// options are invalid
+func New(pattern string, opts Options) (*Searcher, error) {
+	if opts.Encoding == "" {
+		opts.Encoding = EncodingAuto
+	}
+	if !contains(Encodings, opts.Encoding) {
+		return nil, fmt.Errorf("unknown encoding %q", opts.Encoding)
+	}
+	if opts.Normalize != "" && !contains(NormalizationForms, opts.Normalize) {
+		return nil, fmt.Errorf("unknown normalization form %q", opts.Normalize)
+	}
+	if opts.Normalize != "" && (opts.Multiline || opts.Fuzzy > 0) {
+		return nil, errors.New("normalization can't be used with multiline or fuzzy matching")
+	}
+	if opts.Multiline && len(opts.Terms) > 0 {
+		return nil, errors.New("terms can't be used with multiline matching")
+	}
+	if opts.Multiline && opts.Encoding != EncodingAuto && opts.Encoding != EncodingUTF8 {
+		return nil, errors.New("multiline matching only works with UTF-8 input")
+	}
+	if opts.Fuzzy > 0 {
+		if err := checkFuzzy(pattern, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.SmartCase && !hasUpper(pattern, opts.UseRegex) {
+		opts.IgnoreCase = true
+		for _, t := range opts.Terms {
+			if hasUpper(t.Pattern, opts.UseRegex) {
+				opts.IgnoreCase = false
+			}
+		}
+	}
+	s := &Searcher{opts: opts}
+	pattern = s.normalize(pattern)
+	var err error
+	if s.pattern, err = s.compile(pattern); err != nil {
+		return nil, err
+	}
+	for _, t := range opts.Terms {
+		p, err := s.compile(s.normalize(t.Pattern))
+		if err != nil {
+			return nil, err
+		}
+		s.terms = append(s.terms, term{op: t.Op, pattern: p})
+	}
+
+	if opts.Multiline {
+		if s.multiline, err = regexp.Compile(s.multilinePattern(pattern)); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Fuzzy > 0 {
+		s.fuzzy = newFuzzyMatcher(pattern, opts.Fuzzy, opts.IgnoreCase)
+	}
+	if s.pattern.literal == "" {
+		expr := s.pattern.text
+		if !opts.UseRegex {
+			expr = "(?i)" + regexp.QuoteMeta(expr)
+		}
+		if expr, err = lineAnchors(expr); err != nil {
+			return nil, err
+		}
+		s.candidates = regexp.MustCompile(expr)
+	}
+	return s, nil
+}
+
+// normalize applies Options.Normalize to a pattern
+func (s *Searcher) normalize(text string) string {
+	if s.opts.Normalize == "" {
+		return text
+	}
+	return normForm(s.opts.Normalize).String(text)
+}
+
+// compile prepares text, the pattern or a term, for findMatch
+func (s *Searcher) compile(text string) (*pattern, error) {
+	if !s.opts.UseRegex {
+		p := &pattern{text: text, runes: []rune(text)}
+		if !s.opts.IgnoreCase {
+			p.literal = text
+		}
+		return p, nil
+	}
+
+	if s.opts.IgnoreCase {
+		text = "(?i)" + text
+	}
+	re, err := regexp.Compile(text)
+	if err != nil {
+		return nil, err
+	}
+	return &pattern{text: text, re: re, literal: prefilter(text)}, nil
+}
+
+// Regexp returns a regexp that matches the same text as the pattern, without
+// any terms, so that every match in a line can be found rather than only the
+// first
+func (s *Searcher) Regexp() *regexp.Regexp {
+	if s.pattern.re != nil {
+		return s.pattern.re
+	}
+	expr := regexp.QuoteMeta(s.pattern.text)
+	if s.opts.IgnoreCase {
+		expr = "(?i)" + expr
+	}
+	return regexp.MustCompile(expr)
+}
+
+// Literal returns a string that the bytes of every line reported by s
+// contain, and whether it has to be compared ignoring case. It returns ""
+// when there is no such string, as with inverted, fuzzy or normalized
+// matching and TermOr, or when the input is decompressed or isn't UTF-8.
+func (s *Searcher) Literal() (lit string, fold bool) {
+	if s.opts.InvertMatch || s.opts.Fuzzy > 0 || s.opts.Normalize != "" || s.hasTerm(TermOr) {
+		return "", false
+	}
+	if s.opts.SearchZip || s.opts.Encoding != EncodingAuto && s.opts.Encoding != EncodingUTF8 && s.opts.Encoding != "" {
+		return "", false
+	}
+	if !s.opts.UseRegex {
+		return s.pattern.text, s.opts.IgnoreCase
+	}
+	// the literal of the pattern without (?i) is still required, in any case
+	return prefilter(strings.TrimPrefix(s.pattern.text, "(?i)")), s.opts.IgnoreCase
+}
+
+// Search reads r to the end and calls fn with every match in order. name is
+// the name of the input, which decides how some compressed input is read.
+// Search stops and returns the error when fn returns one or ctx is done, and
+// has stopped reading r by the time it returns.
+func (s *Searcher) Search(ctx context.Context, r io.Reader, name string, fn func(*Match) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	// cancelling ctx stops the goroutines reading r once fn wants no more
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if s.opts.SearchZip {
+		zr, err := zipReader(r, name)
+		if err != nil {
+			return err
+		}
+		r = zr
+	}
+	emit := func(m *Match) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(m); err != nil {
+			cancel()
+			return err
+		}
+		return nil
+	}
+
+	// the buffer scanner handles the common case much faster than the
+	// line by line pipeline below
+	if s.canScan() {
+		var utf16 bool
+		if r, utf16 = sniffUTF16(r); !utf16 || s.opts.Encoding == EncodingUTF8 {
+			return s.newBufferScanner(ctx, emit).scan(r)
+		}
+	}
+	return s.searchLines(ctx, r, emit)
+}
+
+// searchLines matches every line of r on its own
+func (s *Searcher) searchLines(ctx context.Context, r io.Reader, emit func(*Match) error) error {
+	lines := make(chan *contextualLine)
+
+	var readErr error
+	go func() {
+		readErr = s.readContextualFile(ctx, r, lines)
+		close(lines)
+	}()
+
+	// with AllMatch nothing is sent until every pattern has been seen
+	var held []*Match
+	patterns := s.queryPatterns()
+	seen := make([]bool, len(patterns))
+
+	for line := range lines {
+		if line == nil || line.Current == nil {
+			continue
+		}
+		if s.opts.AllMatch {
+			s.markSeen(line.Current.Text, patterns, seen)
+		}
+
+		var match string
+		var matched bool
+		distance := 0
+		if s.opts.Multiline {
+			// the multiline reader has already decided which lines match
+			match, matched = line.Current.matchStr, line.Current.matched
+		} else if s.opts.Fuzzy > 0 {
+			match, distance = s.fuzzy.find(line.Current.Text)
+			matched = match != ""
+		} else if s.opts.Normalize != "" {
+			match = s.findNormalized(line.Current.Text)
+			matched = match != ""
+		} else {
+			match = s.matchLine(line.Current.Text)
+			matched = match != ""
+		}
+
+		// XOR - either Invert or it is a match, but not both
+		if s.opts.InvertMatch != matched {
+			m := &Match{
+				MatchStr:    match,
+				LinesBefore: line.LinesBefore,
+				LinesAfter:  line.LinesAfter,
+				Line: &Line{
+					Text:     line.Current.Text,
+					Num:      line.Current.Num,
+					Offset:   line.Current.Offset,
+					Distance: distance,
+				},
+			}
+			if s.opts.AllMatch {
+				held = append(held, m)
+			} else if err := emit(m); err != nil {
+				// ctx is cancelled by now, so the readers are only waited
+				// for until they notice and let go of r
+				for range lines {
+				}
+				return err
+			}
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if readErr != nil {
+		return readErr
+	}
+
+	if s.opts.AllMatch && allSeen(seen) {
+		for _, m := range held {
+			if err := emit(m); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// findMatch returns the first match of p in line, or "" if there is none
+func (s *Searcher) findMatch(line string, p *pattern) string {
+	if p.re != nil {
+		if p.literal != "" && !strings.Contains(line, p.literal) {
+			return ""
+		}
+		return p.re.FindString(line)
+	}
+	if s.opts.IgnoreCase {
+		if start, end := indexFold(line, p.runes); start >= 0 {
+			return line[start:end]
+		}
+	} else if strings.Contains(line, p.text) {
+		return p.text
+	}
+	return ""
+}
+
+type contextualLine struct {
+	LinesBefore []*Line
+	LinesAfter  []*Line
+	Current     *Line
+}
+
+// readContextualFile sends every line of r with its context until r ends or
+// ctx is done. It returns the error that stopped it reading r, if any.
+func (s *Searcher) readContextualFile(ctx context.Context, r io.Reader, to chan<- *contextualLine) error {
+	// ring to hold buffer before and after and current line
+	totalContext := s.opts.BeforeContext + s.opts.AfterContext
+	buffer := ring.New(totalContext + 1)
+
+	// readErr is only read once lineChan is closed
+	var readErr error
+	lineChan := make(chan *Line)
+	go func() {
+		defer close(lineChan)
+		if s.opts.Multiline {
+			readErr = s.readMultilineFile(ctx, r, lineChan)
+		} else {
+			readErr = s.readFile(ctx, r, lineChan)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		// when the file is finished being read the last N lines will remain in the AFTER position
+		// so we push nils into the channel to move the last lines through the current line
+		for i := 0; i < totalContext; i++ {
+			select {
+			case lineChan <- nil:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for line := range lineChan {
+		res := &contextualLine{}
+
+		buffer.Value = line
+		buffer = buffer.Next()
+
+		if line != nil && line.Num <= totalContext {
+			// don't have enough buffer, wait for more
+			continue
+		}
+
+		// start with -1 because i++ is used at the beginning of the Do loop so it can't be missed
+		i := -1
+		buffer.Do(func(b interface{}) {
+			i++
+			var fl *Line
+			if b != nil {
+				fl = b.(*Line)
+			}
+			if i < s.opts.BeforeContext {
+				res.LinesBefore = append(res.LinesBefore, fl)
+				return
+			}
+			if i == s.opts.BeforeContext {
+				res.Current = fl
+				return
+			}
+			res.LinesAfter = append(res.LinesAfter, fl)
+		})
+
+		select {
+		case to <- res:
+		case <-ctx.Done():
+			// the reader stops at its next line
+			for range lineChan {
+			}
+			return ctx.Err()
+		}
+	}
+	return readErr
+}
+
+// readFile sends every line of r until r ends or ctx is done, when it returns
+// the error of ctx. An error reading r is returned after the lines before it
+// have been sent.
+func (s *Searcher) readFile(ctx context.Context, r io.Reader, to chan<- *Line) error {
+	freader := bufio.NewReader(r)
+	dec := newLineDecoder(s.opts.Encoding, freader)
+
+	var offset int64
+	for i := 1; ctx.Err() == nil; i++ {
+		raw, er := dec.readLine(freader)
+		if len(raw) > 0 {
+			text := dec.decode(raw)
+			if i == 1 {
+				text = strings.TrimPrefix(text, bom)
+			}
+			select {
+			case to <- &Line{Num: i, Offset: offset, Text: text}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			offset += int64(len(raw))
+		}
+		if er == io.EOF {
+			break
+		}
+		if er != nil {
+			return er
+		}
+	}
+	return ctx.Err()
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,20 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package grep
+
+import (
+	"errors"
+	"os"
+)
+
+var errNoMmap = errors.New("memory mapping is not supported on this platform")
+
+// mmapFile always fails here so files are read in chunks instead
+func mmapFile(f *os.File, size int64) ([]byte, error) {
+	return nil, errNoMmap
+}
+
+func munmapFile(data []byte) error {
+	return errNoMmap
+}
@@ -0,0 +1,174 @@
+package grep
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"regexp"
+)
+
+// multilineWindow bounds how much of a file is held in memory at once in
+// multiline mode. A match may span at most this many bytes.
+const multilineWindow = 1 << 20
+
+// readMultilineFile reads r in bounded windows and runs the pattern across
+// line boundaries. Every line is sent to the channel, and the lines covered by a
+// match are marked with the part of the match that falls on them. It returns
+// the error of ctx if ctx is done first.
+func (s *Searcher) readMultilineFile(ctx context.Context, r io.Reader, to chan<- *Line) error {
+	re := s.multiline
+
+	ml := &multilineReader{ctx: ctx, to: to, num: 1}
+	chunk := make([]byte, 64*1024)
+	eof := false
+	// readErr is the error that ended the input, reported once the lines
+	// before it have been searched
+	var readErr error
+	want := 2 * multilineWindow
+
+	for {
+		for !eof && len(ml.buf) < want {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			n, err := r.Read(chunk)
+			ml.buf = append(ml.buf, chunk[:n]...)
+			if err != nil {
+				eof = true
+				if err != io.EOF {
+					readErr = err
+				}
+			}
+		}
+
+		if ml.offset == 0 && s.opts.Encoding == EncodingAuto && isUTF16BOM(ml.buf) {
+			return errors.New("multiline matching only works with UTF-8 input")
+		}
+
+		// only matches starting in the first window are taken, which leaves a
+		// whole window after them to match into
+		limit := len(ml.buf)
+		if !eof {
+			limit = multilineWindow
+		}
+
+		pos := 0
+		for pos < len(ml.buf) {
+			loc := re.FindIndex(ml.buf[pos:])
+			if loc == nil || pos+loc[0] >= limit {
+				break
+			}
+			start, end := pos+loc[0], pos+loc[1]
+			last := end - 1
+			if last < start {
+				last = start
+			}
+			// the rest of the last covered line has been reported already,
+			// so searching carries on from the next one
+			next := lineEnd(ml.buf, last)
+			if err := ml.emit(pos, lineStart(ml.buf, start), -1, -1); err != nil {
+				return err
+			}
+			if err := ml.emit(lineStart(ml.buf, start), next, start, end); err != nil {
+				return err
+			}
+			pos = next
+		}
+
+		if eof {
+			if err := ml.emit(pos, len(ml.buf), -1, -1); err != nil {
+				return err
+			}
+			return readErr
+		}
+
+		// keep the line reaching into the second window for the next pass
+		cut := lineStart(ml.buf, limit)
+		if cut < pos {
+			cut = pos
+		}
+		if err := ml.emit(pos, cut, -1, -1); err != nil {
+			return err
+		}
+		ml.offset += int64(cut)
+		ml.buf = append(ml.buf[:0], ml.buf[cut:]...)
+
+		want = 2 * multilineWindow
+		if cut == 0 {
+			// a single line fills the window, so it has to grow
+			want = len(ml.buf) + multilineWindow
+		}
+	}
+}
+
+// multilinePattern turns the search pattern into a regexp where ^ and $ match
+// at every line boundary
+func (s *Searcher) multilinePattern(pattern string) string {
+	if !s.opts.UseRegex {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	if s.opts.IgnoreCase {
+		pattern = "(?i)" + pattern
+	}
+	return "(?m)" + pattern
+}
+
+type multilineReader struct {
+	ctx context.Context
+	to  chan<- *Line
+	buf []byte
+	// num and offset locate the start of buf in the file
+	num    int
+	offset int64
+}
+
+// emit sends the lines in buf[from:to], marking the parts of them that fall
+// in buf[matchStart:matchEnd]. A negative matchStart marks nothing.
+func (ml *multilineReader) emit(from, to, matchStart, matchEnd int) error {
+	for from < to {
+		end := lineEnd(ml.buf, from)
+		line := &Line{
+			Num:    ml.num,
+			Offset: ml.offset + int64(from),
+			Text:   string(trimEOL(ml.buf[from:end])),
+		}
+		if matchStart >= 0 {
+			s, e := from, end
+			if matchStart > s {
+				s = matchStart
+			}
+			if matchEnd < e {
+				e = matchEnd
+			}
+			line.matched = true
+			if s < e {
+				line.matchStr = string(trimEOL(ml.buf[s:e]))
+			}
+		}
+		select {
+		case ml.to <- line:
+		case <-ml.ctx.Done():
+			return ml.ctx.Err()
+		}
+		ml.num++
+		from = end
+	}
+	return nil
+}
+
+// lineStart returns the index in buf where the line containing i starts
+func lineStart(buf []byte, i int) int {
+	if i > len(buf) {
+		i = len(buf)
+	}
+	return bytes.LastIndexByte(buf[:i], '\n') + 1
+}
+
+// lineEnd returns the index in buf just past the end of the line containing i
+func lineEnd(buf []byte, i int) int {
+	if n := bytes.IndexByte(buf[i:], '\n'); n >= 0 {
+		return i + n + 1
+	}
+	return len(buf)
+}
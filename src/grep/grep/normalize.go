@@ -0,0 +1,70 @@
+package grep
+
+import (
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Unicode normalization forms
+const (
+	NormalizeNFC  = "nfc"
+	NormalizeNFD  = "nfd"
+	NormalizeNFKC = "nfkc"
+)
+
+// NormalizationForms are the accepted values of Options.Normalize
+var NormalizationForms = []string{NormalizeNFC, NormalizeNFD, NormalizeNFKC}
+
+// normForm returns the normalization form named form
+func normForm(form string) norm.Form {
+	switch form {
+	case NormalizeNFD:
+		return norm.NFD
+	case NormalizeNFKC:
+		return norm.NFKC
+	}
+	return norm.NFC
+}
+
+// findNormalized is matchLine for Options.Normalize. The line is normalized
+// the same way as the patterns were, and the match is mapped back to the
+// original text so that it is printed and highlighted as it appears in the
+// file.
+func (s *Searcher) findNormalized(line string) string {
+	// spans[i] is where in line the i-th normalized segment came from, and
+	// starts[i] where it begins in the normalized text
+	var spans [][2]int
+	var starts []int
+	var normalized []byte
+
+	var it norm.Iter
+	it.InitString(normForm(s.opts.Normalize), line)
+	for pos := 0; !it.Done(); {
+		seg := it.Next()
+		spans = append(spans, [2]int{pos, it.Pos()})
+		starts = append(starts, len(normalized))
+		normalized = append(normalized, seg...)
+		pos = it.Pos()
+	}
+
+	text := string(normalized)
+	match := s.matchLine(text)
+	if match == "" {
+		return ""
+	}
+	start := strings.Index(text, match)
+	end := start + len(match)
+
+	// widen the match to whole segments of the original text
+	from, to := 0, len(line)
+	for i := range spans {
+		if starts[i] <= start {
+			from = spans[i][0]
+		}
+		if starts[i] < end {
+			to = spans[i][1]
+		}
+	}
+	return line[from:to]
+}
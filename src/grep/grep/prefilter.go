@@ -0,0 +1,74 @@
+package grep
+
+import "regexp/syntax"
+
+// prefilter returns a literal string that every match of the regexp pattern
+// must contain, or "" if there is none. Text without the literal can be
+// skipped without running the regexp at all.
+func prefilter(pattern string) string {
+	if re, err := syntax.Parse(pattern, syntax.Perl); err == nil {
+		return requiredLiteral(re.Simplify())
+	}
+	return ""
+}
+
+// requiredLiteral returns the longest literal that any match of re contains.
+// Case-insensitive literals are left out since a plain substring search can't
+// find them.
+func requiredLiteral(re *syntax.Regexp) string {
+	switch re.Op {
+	case syntax.OpLiteral:
+		if re.Flags&syntax.FoldCase != 0 {
+			return ""
+		}
+		return string(re.Rune)
+	case syntax.OpCapture, syntax.OpPlus:
+		return requiredLiteral(re.Sub[0])
+	case syntax.OpRepeat:
+		if re.Min > 0 {
+			return requiredLiteral(re.Sub[0])
+		}
+	case syntax.OpConcat:
+		// adjacent literals join up into one longer literal
+		best, run := "", ""
+		for _, sub := range re.Sub {
+			if sub.Op == syntax.OpLiteral && sub.Flags&syntax.FoldCase == 0 {
+				run += string(sub.Rune)
+			} else {
+				run = ""
+				if lit := requiredLiteral(sub); len(lit) > len(best) {
+					best = lit
+				}
+			}
+			if len(run) > len(best) {
+				best = run
+			}
+		}
+		return best
+	}
+	return ""
+}
+
+// lineAnchors rewrites the regexp pattern so that all of its anchors, \A and
+// \z as well as ^ and $, match at line boundaries. Run over a whole buffer it
+// then finds what it would find in each line on its own.
+func lineAnchors(pattern string) (string, error) {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return "", err
+	}
+	toLines(re)
+	return re.String(), nil
+}
+
+func toLines(re *syntax.Regexp) {
+	switch re.Op {
+	case syntax.OpBeginText:
+		re.Op = syntax.OpBeginLine
+	case syntax.OpEndText:
+		re.Op = syntax.OpEndLine
+	}
+	for _, sub := range re.Sub {
+		toLines(sub)
+	}
+}
@@ -0,0 +1,82 @@
+package grep
+
+// Kinds of Term
+const (
+	TermAnd = "and"
+	TermOr  = "or"
+	TermNot = "not"
+)
+
+// Term is an extra pattern combined with the main one. Terms are evaluated
+// left to right after the pattern, with TermOr binding loosest.
+type Term struct {
+	Op      string
+	Pattern string
+}
+
+// matchLine is findMatch for the whole query: the pattern followed by any
+// terms, evaluated left to right with TermOr binding loosest, so "A and B or
+// C" means (A and B) or C. The match of the first pattern in the group that
+// matched is returned.
+func (s *Searcher) matchLine(line string) string {
+	match := s.findMatch(line, s.pattern)
+	ok := match != ""
+	for _, t := range s.terms {
+		switch t.op {
+		case TermOr:
+			if ok {
+				return match
+			}
+			match = s.findMatch(line, t.pattern)
+			ok = match != ""
+		case TermAnd:
+			ok = ok && s.findMatch(line, t.pattern) != ""
+		case TermNot:
+			ok = ok && s.findMatch(line, t.pattern) == ""
+		}
+	}
+	if ok {
+		return match
+	}
+	return ""
+}
+
+// hasTerm reports whether a term of the kind op was given
+func (s *Searcher) hasTerm(op string) bool {
+	for _, t := range s.terms {
+		if t.op == op {
+			return true
+		}
+	}
+	return false
+}
+
+// queryPatterns returns the patterns an input must contain for AllMatch: the
+// main pattern and every TermAnd and TermOr term
+func (s *Searcher) queryPatterns() []*pattern {
+	patterns := []*pattern{s.pattern}
+	for _, t := range s.terms {
+		if t.op != TermNot {
+			patterns = append(patterns, t.pattern)
+		}
+	}
+	return patterns
+}
+
+// markSeen records which of patterns match line
+func (s *Searcher) markSeen(line string, patterns []*pattern, seen []bool) {
+	for i, p := range patterns {
+		if !seen[i] && s.findMatch(line, p) != "" {
+			seen[i] = true
+		}
+	}
+}
+
+func allSeen(seen []bool) bool {
+	for _, ok := range seen {
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,323 @@
+package grep
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+const (
+	// scanChunk is how much is read at once from input that can't be mapped
+	scanChunk = 1 << 20
+	// mmapMinSize is the smallest file worth mapping instead of reading
+	mmapMinSize = 1 << 20
+	// parallelChunk is the smallest piece of a mapped file that is searched
+	// on its own goroutine
+	parallelChunk = 16 << 20
+)
+
+// bufferScanner searches large buffers as a whole and only builds lines
+// around candidate matches, instead of sending every line through the
+// channels of readContextualFile.
+type bufferScanner struct {
+	s    *Searcher
+	ctx  context.Context
+	emit func(*Match) error
+	// find returns the index of the first possible match in b, or -1
+	find func(b []byte) int
+}
+
+// canScan reports whether the buffer scanner supports the options of s.
+// Inverted, multiline, fuzzy and AllMatch matching look at every line, as
+// does TermOr since matching lines needn't contain the main pattern. Other
+// encodings and normalization forms have to be converted first.
+func (s *Searcher) canScan() bool {
+	return !s.opts.Multiline && !s.opts.InvertMatch && !s.opts.AllMatch && s.opts.Fuzzy == 0 &&
+		s.opts.Normalize == "" && !s.hasTerm(TermOr) &&
+		(s.opts.Encoding == EncodingAuto || s.opts.Encoding == EncodingUTF8)
+}
+
+// sniffUTF16 reports whether r starts with a UTF-16 byte order mark. The
+// returned reader has to be used in place of r afterwards.
+func sniffUTF16(r io.Reader) (io.Reader, bool) {
+	head := make([]byte, 2)
+	if f, ok := r.(*os.File); ok {
+		// ReadAt leaves the file where it was so it can still be mapped
+		if n, err := f.ReadAt(head, 0); err == nil || n == len(head) {
+			return r, isUTF16BOM(head[:n])
+		}
+	}
+	br := bufio.NewReaderSize(r, scanChunk)
+	head, _ = br.Peek(2)
+	return br, isUTF16BOM(head)
+}
+
+func isUTF16BOM(head []byte) bool {
+	return bytes.HasPrefix(head, bomUTF16LE) || bytes.HasPrefix(head, bomUTF16BE)
+}
+
+func (s *Searcher) newBufferScanner(ctx context.Context, emit func(*Match) error) *bufferScanner {
+	bs := &bufferScanner{s: s, ctx: ctx, emit: emit}
+
+	// every match contains the literal, so only the lines holding it need
+	// to be checked with matchLine
+	if lit := s.pattern.literal; lit != "" {
+		p := []byte(lit)
+		bs.find = func(b []byte) int {
+			return bytes.Index(b, p)
+		}
+	} else {
+		// a match in the buffer is only a candidate; it is confirmed on its
+		// line because it may span lines where the line by line search can't
+		re := s.candidates
+		bs.find = func(b []byte) int {
+			if loc := re.FindIndex(b); loc != nil {
+				return loc[0]
+			}
+			return -1
+		}
+	}
+	return bs
+}
+
+// scan searches all of r, mapping it into memory if it is a large regular
+// file and reading it in big chunks otherwise
+func (bs *bufferScanner) scan(r io.Reader) error {
+	if f, ok := r.(*os.File); ok {
+		if info, err := f.Stat(); err == nil && info.Mode().IsRegular() && info.Size() >= mmapMinSize {
+			if data, err := mmapFile(f, info.Size()); err == nil {
+				err = bs.searchParallel(data)
+				munmapFile(data)
+				return err
+			}
+		}
+	}
+	return bs.scanReader(r)
+}
+
+// scanReader searches r a chunk at a time. Each pass searches the complete
+// lines read so far, except for the last AfterContext ones whose trailing
+// context hasn't arrived yet, and keeps BeforeContext lines for the next.
+func (bs *bufferScanner) scanReader(r io.Reader) error {
+	buf := make([]byte, 0, scanChunk)
+	// base is the offset of buf[0] in the input and num the line number at from
+	var base int64
+	num := 1
+	from := 0
+
+	for {
+		if err := bs.ctx.Err(); err != nil {
+			return err
+		}
+		if len(buf) == cap(buf) {
+			grown := make([]byte, len(buf), 2*cap(buf))
+			copy(grown, buf)
+			buf = grown
+		}
+		n, readErr := r.Read(buf[len(buf):cap(buf)])
+		buf = buf[:len(buf)+n]
+		eof := readErr != nil
+		if base == 0 && from == 0 {
+			from = skipBOM(buf)
+		}
+
+		to := len(buf)
+		if !eof {
+			to = lineStart(buf, len(buf))
+			for i := 0; i < bs.s.opts.AfterContext && to > from; i++ {
+				to = lineStart(buf, to-1)
+			}
+			if to < from {
+				to = from
+			}
+		}
+		var err error
+		if num, err = bs.search(buf, from, to, num, base); err != nil {
+			return err
+		}
+		if eof {
+			// what was read before an error is still searched
+			if readErr == io.EOF {
+				return nil
+			}
+			return readErr
+		}
+
+		keep := to
+		for i := 0; i < bs.s.opts.BeforeContext && keep > 0; i++ {
+			keep = lineStart(buf, keep-1)
+		}
+		buf = buf[:copy(buf, buf[keep:])]
+		base += int64(keep)
+		from = to - keep
+	}
+}
+
+// searchParallel splits data into newline aligned chunks that are searched
+// concurrently. The newlines in each chunk are counted first so every chunk
+// knows its starting line number, and the matches are passed on in file
+// order.
+func (bs *bufferScanner) searchParallel(data []byte) error {
+	bounds := splitChunks(data, runtime.GOMAXPROCS(0))
+	chunks := len(bounds) - 1
+	if chunks == 1 {
+		_, err := bs.search(data, skipBOM(data), len(data), 1, 0)
+		return err
+	}
+
+	counts := make([]int, chunks)
+	wg := &sync.WaitGroup{}
+	wg.Add(chunks)
+	for i := 0; i < chunks; i++ {
+		go func(i int) {
+			counts[i] = bytes.Count(data[bounds[i]:bounds[i+1]], []byte{'\n'})
+			wg.Done()
+		}(i)
+	}
+	wg.Wait()
+
+	results := make([]chan *Match, chunks)
+	num := 1
+	for i := 0; i < chunks; i++ {
+		results[i] = make(chan *Match, 256)
+		go func(i, num int) {
+			chunk := &bufferScanner{s: bs.s, ctx: bs.ctx, find: bs.find, emit: func(m *Match) error {
+				select {
+				case results[i] <- m:
+					return nil
+				case <-bs.ctx.Done():
+					return bs.ctx.Err()
+				}
+			}}
+			from := bounds[i]
+			if i == 0 {
+				from = skipBOM(data)
+			}
+			// context is read from the whole of data so it crosses chunks
+			chunk.search(data, from, bounds[i+1], num, 0)
+			close(results[i])
+		}(i, num)
+		num += counts[i]
+	}
+
+	// every chunk is waited for even after an error, since data is unmapped
+	// once this returns. An error from emit has cancelled ctx so they stop
+	// at their next line.
+	var err error
+	for _, matches := range results {
+		for m := range matches {
+			if err == nil {
+				err = bs.emit(m)
+			}
+		}
+	}
+	if err == nil {
+		err = bs.ctx.Err()
+	}
+	return err
+}
+
+// splitChunks returns the boundaries of at most n chunks of data, each at
+// least parallelChunk bytes and starting at the beginning of a line
+func splitChunks(data []byte, n int) []int {
+	if max := len(data) / parallelChunk; n > max {
+		n = max
+	}
+	bounds := []int{0}
+	for i := 1; i < n; i++ {
+		b := lineEnd(data, i*len(data)/n-1)
+		if b > bounds[len(bounds)-1] && b < len(data) {
+			bounds = append(bounds, b)
+		}
+	}
+	return append(bounds, len(data))
+}
+
+// search emits a Match for every matching line that starts in buf[from:to].
+// from must be the start of line num, and base the offset of buf[0] in the
+// input. Context lines are taken from the rest of buf. The line number at to
+// is returned.
+func (bs *bufferScanner) search(buf []byte, from, to, num int, base int64) (int, error) {
+	pos := from
+	for pos < to {
+		if err := bs.ctx.Err(); err != nil {
+			return num, err
+		}
+		i := bs.find(buf[pos:to])
+		if i < 0 {
+			break
+		}
+		start := lineStart(buf, pos+i)
+		end := lineEnd(buf, pos+i)
+		if start > pos {
+			num += bytes.Count(buf[pos:start], []byte{'\n'})
+		}
+
+		line := bs.line(buf, start, end, num, base)
+		if match := bs.s.matchLine(line.Text); match != "" {
+			err := bs.emit(&Match{
+				MatchStr:    match,
+				Line:        line,
+				LinesBefore: bs.linesBefore(buf, start, num, base),
+				LinesAfter:  bs.linesAfter(buf, end, num, base),
+			})
+			if err != nil {
+				return num, err
+			}
+		}
+		num++
+		pos = end
+	}
+	return num + bytes.Count(buf[pos:to], []byte{'\n'}), nil
+}
+
+// skipBOM returns the length of the UTF-8 byte order mark at the start of
+// buf. Searching starts after it so that ^ matches at the first line.
+func skipBOM(buf []byte) int {
+	if bytes.HasPrefix(buf, []byte(bom)) {
+		return len(bom)
+	}
+	return 0
+}
+
+func (bs *bufferScanner) line(buf []byte, start, end, num int, base int64) *Line {
+	text := string(trimEOL(buf[start:end]))
+	if num == 1 {
+		text = strings.TrimPrefix(text, bom)
+	}
+	return &Line{Text: text, Num: num, Offset: base + int64(start)}
+}
+
+// linesBefore returns up to BeforeContext lines ending at start, the
+// beginning of line num
+func (bs *bufferScanner) linesBefore(buf []byte, start, num int, base int64) []*Line {
+	lines := make([]*Line, bs.s.opts.BeforeContext)
+	end := start
+	for i := len(lines) - 1; i >= 0 && end > 0; i-- {
+		start = lineStart(buf, end-1)
+		lines[i] = bs.line(buf, start, end, num-len(lines)+i, base)
+		end = start
+	}
+	return lines
+}
+
+// linesAfter returns up to AfterContext lines starting at end, just past
+// line num
+func (bs *bufferScanner) linesAfter(buf []byte, end, num int, base int64) []*Line {
+	lines := make([]*Line, bs.s.opts.AfterContext)
+	start := end
+	for i := range lines {
+		if start >= len(buf) {
+			break
+		}
+		end = lineEnd(buf, start)
+		lines[i] = bs.line(buf, start, end, num+1+i, base)
+		start = end
+	}
+	return lines
+}
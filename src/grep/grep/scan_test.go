@@ -0,0 +1,116 @@
+package grep
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// bigInput is over three parallel chunks of numbered lines, with needles on
+// the lines either side of every chunk boundary as well as every 1000th
+func bigInput() []byte {
+	var buf bytes.Buffer
+	for i := 1; buf.Len() < 3*parallelChunk+parallelChunk/2; i++ {
+		fmt.Fprintf(&buf, "line %d of the filler text\n", i)
+	}
+	data := buf.Bytes()
+	for _, b := range splitChunks(data, 4) {
+		for _, at := range []int{b - 2, b} {
+			if at >= 0 && at < len(data) {
+				start := lineStart(data, at)
+				copy(data[start:], "needle")
+			}
+		}
+	}
+	for i := 0; i < len(data); i += 1000 * 27 {
+		copy(data[lineStart(data, i):], "needle")
+	}
+	return data
+}
+
+func TestSplitChunks(t *testing.T) {
+	data := bigInput()
+	for _, n := range []int{1, 2, 4, 64} {
+		bounds := splitChunks(data, n)
+		if bounds[0] != 0 || bounds[len(bounds)-1] != len(data) {
+			t.Fatalf("n=%d: bounds %v don't cover the input", n, bounds)
+		}
+		if max := len(data) / parallelChunk; len(bounds)-1 > n || len(bounds)-1 > max {
+			t.Errorf("n=%d: %d chunks", n, len(bounds)-1)
+		}
+		for i := 1; i < len(bounds)-1; i++ {
+			if bounds[i] <= bounds[i-1] || data[bounds[i]-1] != '\n' {
+				t.Errorf("n=%d: chunk boundary %d isn't the start of a line", n, bounds[i])
+			}
+		}
+	}
+}
+
+// describe turns a match into text that tells it apart from any other
+func describe(m *Match) string {
+	lines := func(ls []*Line) string {
+		var out []string
+		for _, l := range ls {
+			if l != nil {
+				out = append(out, fmt.Sprintf("%d@%d", l.Num, l.Offset))
+			}
+		}
+		return strings.Join(out, ",")
+	}
+	return fmt.Sprintf("%d@%d %q %q [%s] [%s]", m.Line.Num, m.Line.Offset, m.Line.Text, m.MatchStr,
+		lines(m.LinesBefore), lines(m.LinesAfter))
+}
+
+func TestSearchParallel(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	data := bigInput()
+
+	tests := []struct {
+		pattern string
+		opts    Options
+	}{
+		{"needle", Options{}},
+		{"needle", Options{BeforeContext: 2, AfterContext: 1}},
+		// no literal, so the much slower candidates regexp finds the lines
+		{`^needle`, Options{UseRegex: true, IgnoreCase: true, BeforeContext: 1, AfterContext: 2}},
+	}
+	for _, tt := range tests {
+		s, err := New(tt.pattern, tt.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.pattern.literal == "" && testing.Short() {
+			continue
+		}
+		collect := func(search func(*bufferScanner) error) []string {
+			var got []string
+			bs := s.newBufferScanner(context.Background(), func(m *Match) error {
+				got = append(got, describe(m))
+				return nil
+			})
+			if err := search(bs); err != nil {
+				t.Fatal(err)
+			}
+			return got
+		}
+
+		parallel := collect(func(bs *bufferScanner) error { return bs.searchParallel(data) })
+		serial := collect(func(bs *bufferScanner) error { return bs.scanReader(bytes.NewReader(data)) })
+		if len(serial) == 0 {
+			t.Fatalf("%q %+v: no matches", tt.pattern, tt.opts)
+		}
+		if !reflect.DeepEqual(parallel, serial) {
+			t.Errorf("%q %+v: parallel search found %d matches, reading found %d", tt.pattern, tt.opts, len(parallel), len(serial))
+			for i := range serial {
+				if i >= len(parallel) || parallel[i] != serial[i] {
+					t.Errorf("first difference: %v", serial[i])
+					break
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package grep
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	bzip2Magic = []byte("BZh")
+	// a bzip2 stream goes on with a block, or ends at once when it is empty
+	bzip2Block = []byte{0x31, 0x41, 0x59, 0x26, 0x53, 0x59}
+	bzip2End   = []byte{0x17, 0x72, 0x45, 0x38, 0x50, 0x90}
+)
+
+// zipReader wraps r in a decompressing reader when the stream starts with a
+// gzip, bzip2 or zlib header. Anything else is returned unchanged so plain
+// files can be searched alongside compressed ones.
+func zipReader(r io.Reader, fname string) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(10)
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		return gzip.NewReader(br)
+	case isBzip2Header(magic):
+		return bzip2.NewReader(br), nil
+	case isZlibHeader(magic, fname):
+		return zlib.NewReader(br)
+	}
+	return br, nil
+}
+
+// isBzip2Header reports whether magic is the start of a bzip2 stream: "BZh",
+// the block size from 1 to 9 and the magic number of the first block
+func isBzip2Header(magic []byte) bool {
+	if len(magic) < 10 || !bytes.HasPrefix(magic, bzip2Magic) || magic[3] < '1' || magic[3] > '9' {
+		return false
+	}
+	return bytes.Equal(magic[4:], bzip2Block) || bytes.Equal(magic[4:], bzip2End)
+}
+
+// isZlibHeader reports whether magic looks like the start of a zlib stream.
+// Some valid zlib headers are printable ("x^"), so those are only trusted
+// when the file name says it is compressed.
+func isZlibHeader(magic []byte, fname string) bool {
+	if len(magic) < 2 {
+		return false
+	}
+	cmf, flg := magic[0], magic[1]
+	if cmf&0x0f != 8 || cmf>>4 > 7 || (uint16(cmf)<<8|uint16(flg))%31 != 0 {
+		return false
+	}
+	if flg < 0x20 || flg > 0x7e {
+		return true
+	}
+	switch strings.ToLower(filepath.Ext(fname)) {
+	case ".zz", ".zlib":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"grep/grep"
+)
+
+// indexFileName is the trigram index kept at the top of an indexed directory
+const indexFileName = ".grep-go-index"
+
+// binaryPeek is how much of a file is checked for NUL bytes to tell binary
+// files, which aren't indexed, from text
+const binaryPeek = 8000
+
+var errBinary = errors.New("binary file")
+
+// trigramIndex maps every trigram found in a directory tree to the files
+// that contain it. Trigrams are ASCII lowercased so the index also serves
+// case-insensitive searches.
+type trigramIndex struct {
+	Files    []indexedFile
+	Postings map[uint32][]uint32
+}
+
+// indexedFile is a file in the index. Size and ModTime tell whether it has
+// changed since it was indexed.
+type indexedFile struct {
+	Path    string
+	Size    int64
+	ModTime int64
+}
+
+// indexCommand runs "grep-go index build DIR..." and returns the exit status
+func indexCommand(args []string) int {
+	if len(args) == 0 || args[0] != "build" {
+		fmt.Fprintln(os.Stderr, "usage: grep-go index build [DIR...]")
+		return 2
+	}
+	dirs := args[1:]
+	if len(dirs) == 0 {
+		dirs = []string{"."}
+	}
+
+	status := 0
+	for _, dir := range dirs {
+		total, reused, err := buildIndex(dir)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "warning:", err.Error())
+			status = 2
+			continue
+		}
+		fmt.Printf("%s: indexed %d files (%d unchanged)\n", dir, total, reused)
+	}
+	return status
+}
+
+// buildIndex writes the index for dir. Files that have the same size and
+// modification time as in the previous index keep their trigrams from it
+// rather than being read again.
+func buildIndex(dir string) (total, reused int, err error) {
+	previous := map[string][]uint32{}
+	prevFiles := map[string]indexedFile{}
+	if old, err := loadIndex(dir); err == nil {
+		previous = old.fileTrigrams()
+		for _, f := range old.Files {
+			prevFiles[f.Path] = f
+		}
+	}
+
+	idx := &trigramIndex{Postings: map[uint32][]uint32{}}
+	err = walkIndexed(dir, func(path string, f indexedFile) {
+		trigrams, ok := previous[f.Path]
+		if ok && prevFiles[f.Path] == f {
+			reused++
+		} else {
+			var err error
+			if trigrams, err = readTrigrams(path); err != nil {
+				return
+			}
+		}
+
+		id := uint32(len(idx.Files))
+		idx.Files = append(idx.Files, f)
+		for _, t := range trigrams {
+			idx.Postings[t] = append(idx.Postings[t], id)
+		}
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return len(idx.Files), reused, idx.write(dir)
+}
+
+// walkIndexed calls fn with every file under dir as it is now, walking it as
+// a search with --recursive does. "index build" has no flags so it indexes
+// everything but hidden files and directories, while a search keeps to its
+// own --hidden, --max-depth, -L, --one-file-system and type filters.
+func walkIndexed(dir string, fn func(path string, f indexedFile)) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	w := &walker{ctx: context.Background(), found: func(path string, info os.FileInfo) bool {
+		if rel, err := filepath.Rel(dir, path); err == nil {
+			fn(path, indexedFile{Path: rel, Size: info.Size(), ModTime: info.ModTime().UnixNano()})
+		}
+		return true
+	}}
+	dev, _ := deviceID(info)
+	w.walk(dir, info, 0, dev, nil)
+	return nil
+}
+
+// write saves the index through a temporary file so searches never read a
+// partly written index
+func (idx *trigramIndex) write(dir string) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(idx); err != nil {
+		return err
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	return writeAtomic(filepath.Join(dir, indexFileName), info.Mode().Perm()&0666, buf.Bytes())
+}
+
+func loadIndex(dir string) (*trigramIndex, error) {
+	f, err := os.Open(filepath.Join(dir, indexFileName))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	idx := &trigramIndex{}
+	if err := gob.NewDecoder(bufio.NewReader(f)).Decode(idx); err != nil {
+		return nil, fmt.Errorf("%s: %s", f.Name(), err.Error())
+	}
+	return idx, nil
+}
+
+// fileTrigrams turns the postings back into the trigrams of each file
+func (idx *trigramIndex) fileTrigrams() map[string][]uint32 {
+	byID := make([][]uint32, len(idx.Files))
+	for t, ids := range idx.Postings {
+		for _, id := range ids {
+			byID[id] = append(byID[id], t)
+		}
+	}
+	files := make(map[string][]uint32, len(idx.Files))
+	for id, f := range idx.Files {
+		files[f.Path] = byID[id]
+	}
+	return files
+}
+
+// candidates returns the files that contain every one of trigrams, as they
+// were when they were indexed
+func (idx *trigramIndex) candidates(trigrams []uint32) map[string]bool {
+	var ids []uint32
+	for i, t := range trigrams {
+		if i == 0 {
+			ids = idx.Postings[t]
+		} else {
+			ids = intersect(ids, idx.Postings[t])
+		}
+	}
+	if trigrams == nil {
+		for id := range idx.Files {
+			ids = append(ids, uint32(id))
+		}
+	}
+
+	paths := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		paths[idx.Files[id].Path] = true
+	}
+	return paths
+}
+
+// intersect returns the ids in both of the sorted lists a and b
+func intersect(a, b []uint32) []uint32 {
+	var out []uint32
+	for len(a) > 0 && len(b) > 0 {
+		switch {
+		case a[0] < b[0]:
+			a = a[1:]
+		case a[0] > b[0]:
+			b = b[1:]
+		default:
+			out = append(out, a[0])
+			a, b = a[1:], b[1:]
+		}
+	}
+	return out
+}
+
+// readTrigrams returns the distinct trigrams in the file at path
+func readTrigrams(path string) ([]uint32, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReaderSize(f, 64*1024)
+	if head, _ := r.Peek(binaryPeek); bytes.IndexByte(head, 0) >= 0 {
+		return nil, errBinary
+	}
+
+	seen := map[uint32]bool{}
+	var t uint32
+	for n := 0; ; n++ {
+		c, err := r.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		t = (t<<8 | uint32(lowerASCII(c))) & 0xffffff
+		if n >= 2 {
+			seen[t] = true
+		}
+	}
+
+	trigrams := make([]uint32, 0, len(seen))
+	for t := range seen {
+		trigrams = append(trigrams, t)
+	}
+	sort.Slice(trigrams, func(i, j int) bool { return trigrams[i] < trigrams[j] })
+	return trigrams, nil
+}
+
+func lowerASCII(c byte) byte {
+	if 'A' <= c && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
+
+// patternTrigrams returns the trigrams every file matching the search must
+// contain, or nil if the index can't narrow the search down
+func patternTrigrams(searcher *grep.Searcher) []uint32 {
+	// the index has the trigrams of archives, not of their members
+	if opts.Archives {
+		return nil
+	}
+	lit, fold := searcher.Literal()
+	// the Kelvin sign and long s fold to k and s, and non-ASCII letters
+	// fold in ways the lowercased index doesn't know about
+	if fold && strings.IndexFunc(lit, func(r rune) bool {
+		return r >= 0x80 || r == 'k' || r == 'K' || r == 's' || r == 'S'
+	}) >= 0 {
+		return nil
+	}
+
+	var trigrams []uint32
+	for i := 0; i+3 <= len(lit); i++ {
+		trigrams = append(trigrams, uint32(lowerASCII(lit[i]))<<16|uint32(lowerASCII(lit[i+1]))<<8|uint32(lowerASCII(lit[i+2])))
+	}
+	return trigrams
+}
+
+// indexedFiles returns the paths of the files under each indexed directory in
+// dirs that may match the search. Files that have changed or are missing from
+// the index since it was built are always searched.
+func indexedFiles(searcher *grep.Searcher, dirs []string) (paths []string) {
+	trigrams := patternTrigrams(searcher)
+	for _, dir := range dirs {
+		// without an index every file is searched, as it is for a file
+		// that isn't in the index
+		idx, err := loadIndex(dir)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "warning:", err.Error()+", searching without the index")
+			idx = &trigramIndex{}
+		}
+		indexed := make(map[string]indexedFile, len(idx.Files))
+		for _, f := range idx.Files {
+			indexed[f.Path] = f
+		}
+		candidates := idx.candidates(trigrams)
+
+		err = walkIndexed(dir, func(path string, f indexedFile) {
+			if indexed[f.Path] != f || candidates[f.Path] {
+				paths = append(paths, path)
+			}
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "warning:", err.Error())
+		}
+	}
+	return paths
+}
@@ -1,23 +1,49 @@
 package main
 
 import (
-	"bufio"
-	"container/ring"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
 	"regexp"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"code.google.com/p/getopt"
 	"github.com/fatih/color"
+
+	"grep/grep"
 )
 
+// stopGrace is how long searches are given to stop after an interrupt or
+// --timeout before grep-go exits anyway
+const stopGrace = time.Second
+
 var (
-	isStdin   = false
 	printSync = &sync.Mutex{}
 	opts      = &Options{}
 
+	// stdin is standard input, named by --label. It is searched in place of
+	// the path "-".
+	stdin *os.File
+
+	// replacer finds the text to replace when --replace is given
+	replacer *regexp.Regexp
+
+	// errEnough ends the search of a file once no more of its matches are
+	// wanted, for --files-with-matches, --quiet and --max-count
+	errEnough = errors.New("enough matches")
+
+	// cancelSearch stops every search, once --quiet has seen a match
+	cancelSearch context.CancelFunc
+	quietMatched atomic.Bool
+
 	hl = color.New(color.FgRed).SprintfFunc()
 )
 
@@ -27,16 +53,63 @@ func init() {
 
 	getopt.BoolVarLong(&opts.ShowHelp, "help", 'p', "show help information and usage")
 	getopt.BoolVarLong(&opts.ShowVersion, "version", 'V', "show version information")
+	getopt.BoolVarLong(&opts.NoConfig, "no-config", 0, "don't read flags from the config file ($"+configEnv+" or ~/.config/grep-go/config)")
 
 	getopt.BoolVarLong(&opts.UseRegex, "regexp", 'e', "match pattern as regexp")
 	getopt.BoolVarLong(&opts.IgnoreCase, "ignore-case", 'i', "ignore case when searching")
+	getopt.BoolVarLong(&opts.SmartCase, "smart-case", 'S', "ignore case unless the pattern has an uppercase letter")
 	getopt.BoolVarLong(&opts.ListFiles, "files-with-matches", 'l', "only list files, not content")
-	getopt.BoolVarLong(&opts.Color, "color", 'c', "colorize output")
+	getopt.VarLong((*colorValue)(&opts.Color), "color", 'c', "colorize output, or with =WHEN only if WHEN is always or auto and output is a terminal", "WHEN").SetFlag()
 	getopt.BoolVarLong(&opts.NoFileName, "no-filename", 'h', "don't output filenames")
 	getopt.BoolVarLong(&opts.FileName, "filename", 'H', "output filenames (default if more than one file)")
 	getopt.BoolVarLong(&opts.LineNums, "line-number", 'n', "show line numbers")
 	getopt.BoolVarLong(&opts.InvertMatch, "invert-match", 'v', "invert the sense of matching, to select non-matching lines")
+	getopt.BoolVarLong(&opts.Multiline, "multiline", 'U', "let patterns match across lines of UTF-8 input")
+	getopt.BoolVarLong(&opts.OnlyMatching, "only-matching", 'o', "only output the matching part of each line")
 	getopt.BoolVarLong(&opts.Quiet, "quiet", 'q', "invert the sense of matching, to select non-matching lines")
+	getopt.IntVarLong(&opts.MaxCount, "max-count", 'm', "stop reading a file after N matching lines", "N")
+	getopt.VarLong((*durationValue)(&opts.Timeout), "timeout", 0, "stop searching after DURATION, eg 30s or 5m", "DURATION")
+	getopt.VarLong(&termValue{grep.TermAnd, &opts.Terms}, "and", 0, "lines must also match PATTERN", "PATTERN")
+	getopt.VarLong(&termValue{grep.TermOr, &opts.Terms}, "or", 0, "lines may match PATTERN instead of the patterns before it", "PATTERN")
+	getopt.VarLong(&termValue{grep.TermNot, &opts.Terms}, "not", 0, "lines must not match PATTERN", "PATTERN")
+	getopt.BoolVarLong(&opts.AllMatch, "all-match", 0, "only show files where every pattern matches somewhere")
+	getopt.BoolVarLong(&opts.FilesWithAll, "files-with-all", 0, "only list files where every pattern matches somewhere")
+	getopt.ListVarLong(&opts.Type, "type", 't', "only search files of type NAME when looking through directories, see --type-list", "NAME")
+	getopt.ListVarLong(&opts.TypeNot, "type-not", 'T', "don't search files of type NAME when looking through directories", "NAME")
+	getopt.VarLong(typeAddValue{}, "type-add", 0, "add the files matching GLOB to the type NAME, which may be new", "NAME:GLOB")
+	getopt.BoolVarLong(&opts.TypeList, "type-list", 0, "list the file types and the globs they match")
+	getopt.BoolVarLong(&opts.Recursive, "recursive", 'R', "search the files in the directories given and all below them")
+	opts.Directories = "read"
+	getopt.EnumVarLong(&opts.Directories, "directories", 'd', directoryActions, "what to do with directories given: read, skip, or recurse as --recursive does", "ACTION")
+	opts.Devices = "read"
+	getopt.EnumVarLong(&opts.Devices, "devices", 'D', deviceActions, "what to do with devices, FIFOs and sockets given: read or skip", "ACTION")
+	opts.MaxDepth = -1
+	getopt.IntVarLong(&opts.MaxDepth, "max-depth", 0, "only search N levels of directories below those given", "N")
+	getopt.BoolVarLong(&opts.Hidden, "hidden", 0, "search hidden files and directories, whose names start with a dot")
+	getopt.BoolVarLong(&opts.FollowSymlinks, "follow-symlinks", 'L', "follow symbolic links found in directories")
+	getopt.BoolVarLong(&opts.OneFileSystem, "one-file-system", 0, "don't descend into directories on other file systems")
+	getopt.VarLong((*sizeValue)(&opts.MaxFilesize), "max-filesize", 0, "skip files larger than SIZE, eg 500K or 10M", "SIZE")
+	opts.Label = "(standard input)"
+	getopt.StringVarLong(&opts.Label, "label", 0, "show NAME as the file name of standard input", "NAME")
+	getopt.BoolVarLong(&opts.Index, "index", 0, "search the directories given using the index made by \"grep-go index build\"")
+	getopt.BoolVarLong(&opts.LineBuffered, "line-buffered", 0, "write out each match as soon as it is found, as for tail -f pipelines")
+	getopt.BoolVarLong(&opts.Follow, "follow", 0, "keep reading files as they grow, reopening them when they are rotated")
+	getopt.BoolVarLong(&opts.Watch, "watch", 0, "after searching, watch the files and directories given and search files again as they change")
+	getopt.BoolVarLong(&opts.Archives, "archives", 0, "search the members of tar and zip archives")
+	getopt.BoolVarLong(&opts.ByteOffset, "byte-offset", 'b', "show the byte offset of each line in the original file")
+	getopt.BoolVarLong(&opts.SearchZip, "search-zip", 'z', "search inside gzip, bzip2 and zlib compressed files")
+
+	opts.Encoding = grep.EncodingAuto
+	getopt.EnumVarLong(&opts.Encoding, "encoding", 0, grep.Encodings, "text encoding of the input: "+strings.Join(grep.Encodings, ", "), "ENC")
+	getopt.EnumVarLong(&opts.Normalize, "normalize", 0, grep.NormalizationForms, "Unicode normalize the pattern and each line before matching: "+strings.Join(grep.NormalizationForms, ", "), "FORM")
+
+	getopt.StringVarLong(&opts.Replace, "replace", 'r', "replace each match with REPLACEMENT in the output, where $1 and ${name} expand to capture groups", "REPLACEMENT")
+
+	getopt.BoolVarLong(&opts.Write, "write", 0, "apply --replace to the files themselves instead of printing matches")
+	getopt.BoolVarLong(&opts.DryRun, "dry-run", 0, "show what --write would change as a unified diff")
+	getopt.StringVarLong(&opts.Backup, "backup", 0, "keep a copy of each file rewritten by --write with SUFFIX added to its name", "SUFFIX")
+
+	getopt.IntVarLong(&opts.Fuzzy, "fuzzy", 0, "match the pattern with up to K inserted, deleted or substituted characters", "K")
 
 	getopt.IntVarLong(&opts.Context, "context", 'C', "show N lines of context on each side")
 	getopt.IntVarLong(&opts.BeforeContext, "before", 'B', "show N lines of context before matches")
@@ -44,19 +117,60 @@ func init() {
 }
 
 func main() {
-	pattern, files := parseArgs()
+	if len(os.Args) > 2 && os.Args[1] == "index" && os.Args[2] == "build" {
+		os.Exit(indexCommand(os.Args[2:]))
+	}
+
+	searcher, paths := parseArgs()
+
+	// writes to a closed pipe fail with EPIPE instead of killing grep-go, so
+	// that it can stop and exit in its own time
+	signal.Ignore(syscall.SIGPIPE)
 
-	wg := &sync.WaitGroup{}
-	wg.Add(len(files))
+	// an interrupt or --timeout stops every search
+	interrupted, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ctx := interrupted
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+	ctx, cancelSearch = context.WithCancel(ctx)
+
+	done := make(chan struct{})
+	go func() {
+		searchPaths(ctx, searcher, paths)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		// searches stop at their next line, but a read from a terminal or a
+		// pipe can't be interrupted so they only get a moment to get there
+		select {
+		case <-done:
+		case <-time.After(stopGrace):
+		}
+	}
 
-	for _, file := range files {
-		go func(f *os.File) {
-			processFile(f, pattern)
-			wg.Done()
-		}(file)
+	if opts.Watch && ctx.Err() == nil {
+		if err := watchFiles(ctx, searcher, paths); err != nil && ctx.Err() == nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(2)
+		}
 	}
 
-	wg.Wait()
+	exitOnWriteError()
+	switch {
+	case quietMatched.Load():
+		os.Exit(0)
+	case interrupted.Err() != nil:
+		os.Exit(130)
+	case ctx.Err() == context.DeadlineExceeded:
+		fmt.Fprintln(os.Stderr, "search timed out after", opts.Timeout)
+		os.Exit(2)
+	}
 
 	// if we've made it this far then no matches were found and if Quiet is specified
 	// we need to exit 1
@@ -66,55 +180,92 @@ func main() {
 
 }
 
-func processFile(file *os.File, pattern string) {
-	matches := make(chan *Match)
+func processFile(ctx context.Context, file *os.File, searcher *grep.Searcher) {
+	defer file.Close()
 
-	go grepFile(file, pattern, matches)
+	var err error
+	if opts.Write {
+		err = rewriteFile(ctx, file, searcher)
+	} else if kind := archiveKind(file.Name()); opts.Archives && kind != "" {
+		err = searchArchive(ctx, file, kind, searcher)
+	} else if opts.Follow && file != stdin {
+		fr := newFollowReader(ctx, file)
+		err = searchReader(ctx, fr, file.Name(), searcher)
+		fr.Close()
+	} else if opts.Watch {
+		// watched files are expected to change while they are searched, and
+		// a mapped file that is truncated faults on the pages past its new
+		// end, so hiding the *os.File makes the search read it instead
+		err = searchReader(ctx, struct{ io.Reader }{file}, file.Name(), searcher)
+	} else {
+		err = searchReader(ctx, file, file.Name(), searcher)
+	}
+	// a search cut short by ctx isn't worth a warning
+	if err != nil && ctx.Err() == nil {
+		fmt.Fprintln(os.Stderr, "warning:", file.Name()+":", err.Error())
+	}
+}
 
+// searchReader greps everything read from r and prints the results under
+// fname
+func searchReader(ctx context.Context, r io.Reader, fname string, searcher *grep.Searcher) error {
 	if opts.ListFiles || opts.Quiet {
-		// if a match is returned then print the file name and move on
-		if <-matches != nil {
-			// if the file has a match and the user has specified Quiet then exit 0
-			if opts.Quiet {
-				os.Exit(0)
-			}
-			printSync.Lock()
-			fmt.Println(file)
-			printSync.Unlock()
+		// the first match is enough to print the file name and move on
+		err := searcher.Search(ctx, r, fname, func(*grep.Match) error {
+			return errEnough
+		})
+		if err != errEnough {
+			return err
+		}
+		// if the file has a match and the user has specified Quiet then
+		// there is nothing left to do but exit 0
+		if opts.Quiet {
+			quietMatched.Store(true)
+			cancelSearch()
+			return nil
 		}
-		// channel was closed without any results so there is no match
-		return
+		printSync.Lock()
+		fmt.Fprintln(stdout, fname)
+		printSync.Unlock()
+		return nil
 	}
 
-	output := ""
-	fname := file.Name()
-	for match := range matches {
+	out := &resultWriter{}
+	defer out.Close()
+
+	count := 0
+	err := searcher.Search(ctx, r, fname, func(match *grep.Match) error {
+		if count > 0 && opts.BeforeContext+opts.AfterContext > 0 {
+			out.WriteString("--\n--\n")
+		}
 		for _, l := range match.LinesBefore {
 			if l != nil {
-				output += lineFmt(fname, *l, "")
+				out.WriteString(lineFmt(fname, *l, ""))
 			}
 		}
 
-		output += lineFmt(fname, *match.Line, match.MatchStr)
+		out.WriteString(lineFmt(fname, *match.Line, match.MatchStr))
 
 		for _, l := range match.LinesAfter {
 			if l != nil {
-				output += lineFmt(fname, *l, "")
+				out.WriteString(lineFmt(fname, *l, ""))
 			}
 		}
-		if opts.BeforeContext+opts.AfterContext > 0 {
-			output += "--\n--\n"
+		out.endMatch()
+
+		count++
+		if opts.MaxCount > 0 && count >= opts.MaxCount {
+			return errEnough
 		}
+		return nil
+	})
+	if err == errEnough {
+		err = nil
 	}
-	output = strings.TrimRight(output, "--\n--\n")
-	if output != "" {
-		printSync.Lock()
-		fmt.Println(output)
-		printSync.Unlock()
-	}
+	return err
 }
 
-func lineFmt(fname string, l fileLine, matchStr string) string {
+func lineFmt(fname string, l grep.Line, matchStr string) string {
 	var parts []string
 	if !opts.NoFileName {
 		parts = append(parts, fname)
@@ -122,17 +273,31 @@ func lineFmt(fname string, l fileLine, matchStr string) string {
 	if opts.LineNums {
 		parts = append(parts, fmt.Sprintf("%d", l.Num))
 	}
+	if opts.ByteOffset {
+		parts = append(parts, fmt.Sprintf("%d", l.Offset))
+	}
+	if opts.Fuzzy > 0 && matchStr != "" {
+		parts = append(parts, fmt.Sprintf("d=%d", l.Distance))
+	}
 
 	sep := ":"
 	if matchStr == "" {
 		sep = "-"
 	}
-	output := strings.Join(parts, sep) + sep
+	output := ""
+	if len(parts) > 0 {
+		output = strings.Join(parts, sep) + sep
+	}
 
 	if opts.OnlyMatching {
+		if replacer != nil {
+			matchStr = replaceMatches(matchStr)
+		}
 		output += matchStr
 	} else {
-		if opts.Color {
+		if replacer != nil && matchStr != "" {
+			l.Text = replaceMatches(l.Text)
+		} else if opts.Color {
 			l.Text = strings.Replace(l.Text, matchStr, hl(matchStr), -1)
 		}
 		output += fmt.Sprintf("%s", l.Text)
@@ -140,9 +305,29 @@ func lineFmt(fname string, l fileLine, matchStr string) string {
 	return output + "\n"
 }
 
-func parseArgs() (pattern string, files []*os.File) {
-	getopt.Parse()
-	args := getopt.Args()
+// replaceMatches substitutes the --replace template for every match in s,
+// expanding capture group references. Files are never modified.
+func replaceMatches(s string) string {
+	var out []byte
+	last := 0
+	for _, loc := range replacer.FindAllStringSubmatchIndex(s, -1) {
+		out = append(out, s[last:loc[0]]...)
+		repl := replacer.ExpandString(nil, opts.Replace, s, loc)
+		if opts.Color {
+			repl = []byte(hl("%s", repl))
+		}
+		out = append(out, repl...)
+		last = loc[1]
+	}
+	return string(append(out, s[last:]...))
+}
+
+func parseArgs() (searcher *grep.Searcher, paths []string) {
+	args := os.Args[1:]
+	if !noConfig(args) {
+		parseConfig()
+	}
+	args = parseFlags(args)
 
 	if opts.ShowVersion {
 		fmt.Println("grep-go")
@@ -156,6 +341,10 @@ func parseArgs() (pattern string, files []*os.File) {
 		getopt.Usage()
 		os.Exit(0)
 	}
+	if opts.TypeList {
+		printFileTypes()
+		os.Exit(0)
+	}
 	if len(args) == 0 {
 		getopt.Usage()
 		os.Exit(0)
@@ -164,22 +353,20 @@ func parseArgs() (pattern string, files []*os.File) {
 	if opts.Color {
 		color.NoColor = false
 	}
-	if len(files) == 1 && !opts.FileName {
-		opts.NoFileName = true
+	stdin = os.NewFile(uintptr(syscall.Stdin), opts.Label)
+	for _, names := range [][]string{opts.Type, opts.TypeNot} {
+		if err := checkFileTypes(names); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(2)
+		}
+	}
+	if opts.FilesWithAll {
+		opts.ListFiles = true
+		opts.AllMatch = true
 	}
 
-	// parse pattern and file from remaining arguments
-	if len(args) == 1 {
-		isStdin = true
-		files = append(files, os.Stdin)
-	} else {
-		for _, f := range args[1:] {
-			if fl, err := os.Open(f); err == nil {
-				files = append(files, fl)
-			} else {
-				fmt.Println("warning:", err.Error())
-			}
-		}
+	if opts.Directories == "recurse" {
+		opts.Recursive = true
 	}
 
 	// this makes things easier later
@@ -187,156 +374,127 @@ func parseArgs() (pattern string, files []*os.File) {
 		opts.BeforeContext = opts.Context
 		opts.AfterContext = opts.Context
 	}
-	return args[0], files
-}
 
-func grepFile(file *os.File, pattern string, to chan<- *Match) {
-	if opts.UseRegex && opts.IgnoreCase {
-		pattern = "(?i)" + pattern
+	searcher, err := grep.New(args[0], opts.Options)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
 	}
-	lines := make(chan *contextualLine)
-
-	go readContextualFile(file, lines)
-
-	for line := range lines {
-		if line == nil || line.Current == nil {
-			continue
-		}
 
-		match := findMatch(line.Current.Text, pattern)
-
-		// XOR - either Invert or it is a match, but not both
-		if opts.InvertMatch != (match != "") {
-			to <- &Match{
-				MatchStr:    match,
-				LinesBefore: line.LinesBefore,
-				LinesAfter:  line.LinesAfter,
-				Line: &fileLine{
-					Text: line.Current.Text,
-					Num:  line.Current.Num,
-				},
-			}
+	// parse pattern and file from remaining arguments
+	if opts.Index {
+		dirs := args[1:]
+		if len(dirs) == 0 {
+			dirs = []string{"."}
 		}
+		paths = indexedFiles(searcher, dirs)
+	} else if len(args) == 1 {
+		paths = []string{"-"}
+	} else {
+		paths = args[1:]
 	}
 
-	close(to)
-}
+	// like grep, a lone file is searched without its name. Archive members
+	// still need theirs.
+	if len(paths) == 1 && !opts.FileName && !opts.Index && !opts.Recursive && !opts.Archives {
+		opts.NoFileName = true
+	}
+	// standard input is read to its end by the search, before anything is
+	// watched
+	if opts.Watch && slices.Contains(paths, "-") {
+		fmt.Fprintln(os.Stderr, "--watch can't watch standard input")
+		os.Exit(2)
+	}
 
-func findMatch(s string, pattern string) (match string) {
-	if opts.UseRegex {
-		r := regexp.MustCompile(pattern)
-		finds := r.FindAllString(s, -1)
-		if finds != nil {
-			return finds[0]
-		}
-	} else {
-		if opts.IgnoreCase && strings.Contains(strings.ToLower(s), strings.ToLower(pattern)) {
-			return pattern
-		} else if strings.Contains(s, pattern) {
-			return pattern
+	if getopt.IsSet("replace") {
+		// the replacement is made where the pattern matches exactly
+		if opts.Fuzzy > 0 || opts.Normalize != "" {
+			fmt.Fprintln(os.Stderr, "--replace can't be used with --fuzzy or --normalize")
+			os.Exit(2)
 		}
+		replacer = searcher.Regexp()
 	}
-	return ""
-}
 
-type contextualLine struct {
-	LinesBefore []*fileLine
-	LinesAfter  []*fileLine
-	Current     *fileLine
+	if opts.DryRun {
+		opts.Write = true
+	}
+	if opts.Write && replacer == nil {
+		fmt.Fprintln(os.Stderr, "--write requires --replace")
+		os.Exit(2)
+	}
+	// the replacement is made in the raw text of each matching line, which
+	// these change or don't have
+	if opts.Write && (opts.InvertMatch || opts.Multiline ||
+		opts.SearchZip || opts.Archives || opts.Encoding != grep.EncodingAuto && opts.Encoding != grep.EncodingUTF8) {
+		fmt.Fprintln(os.Stderr, "--write can't be used with --invert-match, --multiline, --search-zip, --archives or --encoding other than utf-8")
+		os.Exit(2)
+	}
+	return searcher, paths
 }
 
-func readContextualFile(file *os.File, to chan<- *contextualLine) {
-	// ring to hold buffer before and after and current line
-	totalContext := opts.BeforeContext + opts.AfterContext
-	buffer := ring.New(totalContext + 1)
-
-	lineChan := make(chan *fileLine)
-	go func() {
-		readFile(file, lineChan)
-		// when the file is finished being read the last N lines will remain in the AFTER position
-		// so we push nils into the channel to move the last lines through the current line
-		for i := 0; i < totalContext; i++ {
-			lineChan <- nil
+// parseFlags parses the flags in args and returns the arguments left. Flags
+// may come after the pattern and files as well as before them, but nothing
+// after "--" is taken as a flag.
+func parseFlags(args []string) (rest []string) {
+	args, err := termArgs(args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	for {
+		getopt.CommandLine.Parse(append([]string{os.Args[0]}, args...))
+		args = getopt.Args()
+		if getopt.CommandLine.State == getopt.DashDash {
+			return append(rest, args...)
 		}
-		close(lineChan)
-	}()
-
-	for line := range lineChan {
-		res := &contextualLine{}
-
-		buffer.Value = line
-		buffer = buffer.Next()
-
-		if line != nil && line.Num <= totalContext {
-			// don't have enough buffer, wait for more
-			continue
+		for len(args) > 0 && (args[0] == "-" || !strings.HasPrefix(args[0], "-")) {
+			rest = append(rest, args[0])
+			args = args[1:]
 		}
-
-		// start with -1 because i++ is used at the beginning of the Do loop so it can't be missed
-		i := -1
-		buffer.Do(func(b interface{}) {
-			i++
-			var fl *fileLine
-			if b != nil {
-				fl = b.(*fileLine)
-			}
-			if i < opts.BeforeContext {
-				res.LinesBefore = append(res.LinesBefore, fl)
-				return
-			}
-			if i == opts.BeforeContext {
-				res.Current = fl
-				return
-			}
-			res.LinesAfter = append(res.LinesAfter, fl)
-		})
-
-		to <- res
-	}
-	close(to)
-}
-
-func readFile(file *os.File, to chan<- *fileLine) {
-	defer file.Close()
-
-	freader := bufio.NewReader(file)
-	for i := 1; ; i++ {
-		line, _, er := freader.ReadLine()
-		if er != nil {
-			break
+		if len(args) == 0 {
+			return rest
 		}
-		to <- &fileLine{Num: i, Text: string(line)}
 	}
 }
 
 // Options from the command line
 type Options struct {
-	AfterContext  int
-	BeforeContext int
-	Color         bool
-	Context       int
-	FileName      bool
-	IgnoreCase    bool
-	InvertMatch   bool
-	LineNums      bool
-	ListFiles     bool
-	NoFileName    bool
-	OnlyMatching  bool
-	Quiet         bool
-	ShowHelp      bool
-	ShowVersion   bool
-	UseRegex      bool
-}
-
-type fileLine struct {
-	Text string
-	Num  int
-}
-
-// Match is a matching line from a file
-type Match struct {
-	Line        *fileLine
-	MatchStr    string
-	LinesBefore []*fileLine
-	LinesAfter  []*fileLine
+	grep.Options
+
+	Archives       bool
+	Backup         string
+	ByteOffset     bool
+	Color          bool
+	Context        int
+	Devices        string
+	Directories    string
+	DryRun         bool
+	FileName       bool
+	FilesWithAll   bool
+	Follow         bool
+	FollowSymlinks bool
+	Hidden         bool
+	Index          bool
+	Label          string
+	LineBuffered   bool
+	LineNums       bool
+	ListFiles      bool
+	MaxCount       int
+	MaxDepth       int
+	MaxFilesize    int64
+	NoConfig       bool
+	NoFileName     bool
+	OneFileSystem  bool
+	OnlyMatching   bool
+	Quiet          bool
+	Recursive      bool
+	Replace        string
+	ShowHelp       bool
+	ShowVersion    bool
+	Timeout        time.Duration
+	Type           []string
+	TypeList       bool
+	TypeNot        []string
+	Watch          bool
+	Write          bool
 }
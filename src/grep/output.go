@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"syscall"
+)
+
+// outputBlock is how much output a file collects before writing it out in
+// one go
+const outputBlock = 64 * 1024
+
+// stdout is where results are printed. Once a write to it fails, usually
+// because the reader of a pipe has gone away, nothing more can be shown so
+// every search is stopped.
+var stdout = &outputWriter{w: os.Stdout}
+
+// outputWriter passes writes on to w until one of them fails
+type outputWriter struct {
+	w   io.Writer
+	mu  sync.Mutex
+	err error
+}
+
+func (o *outputWriter) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.err != nil {
+		return 0, o.err
+	}
+	n, err := o.w.Write(p)
+	if err != nil {
+		o.err = err
+		if cancelSearch != nil {
+			cancelSearch()
+		}
+	}
+	return n, err
+}
+
+// failed returns the error of the write that failed, if any
+func (o *outputWriter) failed() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.err
+}
+
+// exitOnWriteError exits if writing to stdout has failed. A closed pipe is
+// how "grep-go foo | head" normally ends, so it exits quietly with the status
+// a shell reports for SIGPIPE; anything else is an error.
+func exitOnWriteError() {
+	err := stdout.failed()
+	if err == nil {
+		return
+	}
+	if errors.Is(err, syscall.EPIPE) {
+		os.Exit(128 + int(syscall.SIGPIPE))
+	}
+	fmt.Fprintln(os.Stderr, "write error:", err.Error())
+	os.Exit(2)
+}
+
+// resultWriter collects the output of one file and writes it to stdout in
+// blocks as it goes. The first time a file has a block to write it takes
+// printSync, if no other file has it, and keeps it until the file is done so
+// that the output of files running side by side isn't mixed up. A file that
+// can't take it keeps collecting until Close.
+type resultWriter struct {
+	buf bytes.Buffer
+	// owner is set while the file holds printSync
+	owner bool
+}
+
+func (w *resultWriter) WriteString(s string) {
+	w.buf.WriteString(s)
+}
+
+// endMatch is called after the lines of each match have been written. With
+// --line-buffered and --follow every match is written out straight away,
+// between the output of other files if need be.
+func (w *resultWriter) endMatch() {
+	switch {
+	case opts.LineBuffered || opts.Follow:
+		if !w.owner {
+			printSync.Lock()
+			defer printSync.Unlock()
+		}
+		w.flush()
+	case w.buf.Len() >= outputBlock:
+		if w.owner || printSync.TryLock() {
+			w.owner = true
+			w.flush()
+		}
+	}
+}
+
+func (w *resultWriter) flush() {
+	stdout.Write(w.buf.Bytes())
+	w.buf.Reset()
+}
+
+// Close writes out the rest of the output and lets other files print
+func (w *resultWriter) Close() {
+	if !w.owner {
+		if w.buf.Len() == 0 {
+			return
+		}
+		printSync.Lock()
+	}
+	w.flush()
+	w.owner = false
+	printSync.Unlock()
+}
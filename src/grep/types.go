@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// fileTypes maps the names given to --type and --type-not to the globs
+// matching the base names of their files
+var fileTypes = map[string][]string{
+	"c":         {"*.c", "*.h"},
+	"cpp":       {"*.cpp", "*.cc", "*.cxx", "*.hpp", "*.hh", "*.hxx"},
+	"cs":        {"*.cs"},
+	"css":       {"*.css", "*.scss", "*.sass", "*.less"},
+	"docker":    {"Dockerfile", "*.dockerfile"},
+	"go":        {"*.go"},
+	"html":      {"*.html", "*.htm"},
+	"java":      {"*.java"},
+	"js":        {"*.js", "*.jsx", "*.mjs", "*.cjs"},
+	"json":      {"*.json"},
+	"kotlin":    {"*.kt", "*.kts"},
+	"make":      {"Makefile", "makefile", "GNUmakefile", "*.mk"},
+	"md":        {"*.md", "*.markdown"},
+	"php":       {"*.php"},
+	"proto":     {"*.proto"},
+	"py":        {"*.py", "*.pyi"},
+	"ruby":      {"*.rb", "Gemfile", "Rakefile"},
+	"rust":      {"*.rs"},
+	"sh":        {"*.sh", "*.bash", "*.zsh"},
+	"sql":       {"*.sql"},
+	"swift":     {"*.swift"},
+	"terraform": {"*.tf", "*.tfvars"},
+	"toml":      {"*.toml"},
+	"ts":        {"*.ts", "*.tsx"},
+	"txt":       {"*.txt"},
+	"xml":       {"*.xml"},
+	"yaml":      {"*.yaml", "*.yml"},
+}
+
+// addFileType adds the globs of a --type-add value, "name:glob,glob", to
+// the type name, which is created if it doesn't exist yet
+func addFileType(def string) error {
+	name, globs, ok := strings.Cut(def, ":")
+	if !ok || name == "" || globs == "" {
+		return fmt.Errorf("--type-add %q: expected NAME:GLOB", def)
+	}
+	for _, glob := range strings.Split(globs, ",") {
+		if _, err := filepath.Match(glob, ""); err != nil {
+			return fmt.Errorf("--type-add %q: %s", def, err.Error())
+		}
+		fileTypes[name] = append(fileTypes[name], glob)
+	}
+	return nil
+}
+
+// checkFileTypes reports the first of names that isn't a known type
+func checkFileTypes(names []string) error {
+	for _, name := range names {
+		if _, ok := fileTypes[name]; !ok {
+			return fmt.Errorf("unknown file type %q, see --type-list", name)
+		}
+	}
+	return nil
+}
+
+// printFileTypes lists every type and its globs for --type-list
+func printFileTypes() {
+	var names []string
+	for name := range fileTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(stdout, "%s: %s\n", name, strings.Join(fileTypes[name], ", "))
+	}
+}
+
+// isType reports whether the base name of path matches a glob of any of the
+// types in names
+func isType(path string, names []string) bool {
+	base := filepath.Base(path)
+	for _, name := range names {
+		for _, glob := range fileTypes[name] {
+			if ok, _ := filepath.Match(glob, base); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// wantFile reports whether a file found in a directory is searched, given
+// --type and --type-not. Files named on the command line always are.
+func wantFile(path string) bool {
+	if len(opts.TypeNot) > 0 && isType(path, opts.TypeNot) {
+		return false
+	}
+	return len(opts.Type) == 0 || isType(path, opts.Type)
+}
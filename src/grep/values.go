@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.google.com/p/getopt"
+
+	"grep/grep"
+)
+
+// termValue is the getopt value of --and, --or and --not. They all append to
+// the same list so the order they were given in is kept.
+type termValue struct {
+	op    string
+	terms *[]grep.Term
+}
+
+func (v *termValue) Set(value string, opt getopt.Option) error {
+	*v.terms = append(*v.terms, grep.Term{Op: v.op, Pattern: value})
+	return nil
+}
+
+func (v *termValue) String() string {
+	return ""
+}
+
+// termArgs lets a term be given as "--and -e PATTERN", like the pattern
+// itself, by moving the -e in front of it. Any other separate term value that
+// looks like a flag is most likely a mistake, so it is an error; one that
+// really starts with a dash can be joined on with "=".
+func termArgs(args []string) ([]string, error) {
+	args = append([]string(nil), args...)
+	for i := 0; i+1 < len(args); i++ {
+		switch args[i] {
+		case "--":
+			return args, nil
+		case "--and", "--or", "--not":
+			next := args[i+1]
+			if next == "-e" || next == "--regexp" {
+				args[i], args[i+1] = next, args[i]
+				i++
+			} else if strings.HasPrefix(next, "-") && next != "-" {
+				return nil, fmt.Errorf("%s takes a pattern, not the flag %s; use %s=%s for a pattern starting with -", args[i], next, args[i], next)
+			}
+			i++
+		}
+	}
+	return args, nil
+}
+
+// colorValue is the getopt value of --color. On its own it turns colour on,
+// and like grep it also takes always, never or auto, which colours output
+// only when it goes to a terminal.
+type colorValue bool
+
+func (c *colorValue) Set(value string, opt getopt.Option) error {
+	switch strings.ToLower(value) {
+	case "", "always", "true":
+		*c = true
+	case "never", "false":
+		*c = false
+	case "auto":
+		info, err := os.Stdout.Stat()
+		*c = colorValue(err == nil && info.Mode()&os.ModeCharDevice != 0)
+	default:
+		return fmt.Errorf("invalid value %q, want always, never or auto", value)
+	}
+	return nil
+}
+
+func (c *colorValue) String() string {
+	return strconv.FormatBool(bool(*c))
+}
+
+// durationValue is the getopt value of --timeout
+type durationValue time.Duration
+
+func (d *durationValue) Set(value string, opt getopt.Option) error {
+	v, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = durationValue(v)
+	return nil
+}
+
+func (d *durationValue) String() string {
+	return time.Duration(*d).String()
+}
+
+// typeAddValue is the getopt value of --type-add. Unlike a list it isn't
+// split on commas, which separate the globs of the type.
+type typeAddValue struct{}
+
+func (typeAddValue) Set(value string, opt getopt.Option) error {
+	return addFileType(value)
+}
+
+func (typeAddValue) String() string {
+	return ""
+}
+
+// sizeValue is the getopt value of --max-filesize, a number of bytes with an
+// optional K, M or G suffix
+type sizeValue int64
+
+func (v *sizeValue) Set(value string, opt getopt.Option) error {
+	if value == "" {
+		return fmt.Errorf("invalid size %q", value)
+	}
+	num, mult := value, int64(1)
+	switch strings.ToUpper(value[len(value)-1:]) {
+	case "K":
+		mult = 1 << 10
+	case "M":
+		mult = 1 << 20
+	case "G":
+		mult = 1 << 30
+	}
+	if mult > 1 {
+		num = value[:len(value)-1]
+	}
+	n, err := strconv.ParseInt(num, 10, 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid size %q", value)
+	}
+	*v = sizeValue(n * mult)
+	return nil
+}
+
+func (v *sizeValue) String() string {
+	return strconv.FormatInt(int64(*v), 10)
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"grep/grep"
+)
+
+// actions for --directories and --devices. Reading a directory only reports
+// that it is one.
+var (
+	directoryActions = []string{"read", "skip", "recurse"}
+	deviceActions    = []string{"read", "skip"}
+)
+
+// walker finds the files to search under the paths given on the command
+// line and hands them to the workers
+type walker struct {
+	ctx context.Context
+	// found is called with every file to search, and stops the walk by
+	// returning false
+	found func(path string, info os.FileInfo) bool
+	// visit, if set, is called with every directory walked, as --watch
+	// needs to know them rather than their files
+	visit func(dir string, depth int, dev uint64)
+}
+
+// searchPaths searches the files found under roots, at most GOMAXPROCS of
+// them at once. A followed file is never done so each of those gets a worker
+// of its own.
+func searchPaths(ctx context.Context, searcher *grep.Searcher, roots []string) {
+	files := make(chan string)
+	go walkFiles(ctx, roots, files)
+
+	workers := make(chan struct{}, runtime.GOMAXPROCS(0))
+	wg := &sync.WaitGroup{}
+	for path := range files {
+		if !opts.Follow {
+			workers <- struct{}{}
+		}
+		wg.Add(1)
+		go func(path string) {
+			defer wg.Done()
+			if path == "-" {
+				processFile(ctx, stdin, searcher)
+			} else if file, err := os.Open(path); err == nil {
+				processFile(ctx, file, searcher)
+			} else {
+				fmt.Fprintln(os.Stderr, "warning:", err.Error())
+			}
+			if !opts.Follow {
+				<-workers
+			}
+		}(path)
+	}
+	wg.Wait()
+}
+
+// walkFiles sends the files to search under each of roots to files and then
+// closes it. Each root is looked at before it is opened so that directories
+// and devices are handled as --directories and --devices say.
+func walkFiles(ctx context.Context, roots []string, files chan<- string) {
+	defer close(files)
+
+	w := &walker{ctx: ctx, found: func(path string, _ os.FileInfo) bool {
+		select {
+		case files <- path:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}}
+	for _, root := range roots {
+		if root == "-" {
+			if !w.found(root, nil) {
+				return
+			}
+			continue
+		}
+		info, err := os.Stat(root)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "warning:", err.Error())
+			continue
+		}
+		switch {
+		case info.IsDir() && opts.Recursive:
+			dev, _ := deviceID(info)
+			if !w.walk(root, info, 0, dev, nil) {
+				return
+			}
+			continue
+		case info.IsDir():
+			if opts.Directories != "skip" {
+				fmt.Fprintln(os.Stderr, "warning:", root+": Is a directory")
+			}
+			continue
+		case isDevice(info) && opts.Devices == "skip":
+			continue
+		}
+		if !tooBig(info) && !w.found(root, info) {
+			return
+		}
+	}
+}
+
+// walk sends the files under dir, which is depth directories below a root on
+// the device dev. ancestors are the directories above it, to catch symbolic
+// links that loop back up. It returns false once ctx is done.
+func (w *walker) walk(dir string, info os.FileInfo, depth int, dev uint64, ancestors []os.FileInfo) bool {
+	if opts.MaxDepth >= 0 && depth >= opts.MaxDepth {
+		return true
+	}
+	for _, a := range ancestors {
+		if os.SameFile(a, info) {
+			fmt.Fprintln(os.Stderr, "warning:", dir+": recursive directory loop")
+			return true
+		}
+	}
+	ancestors = append(ancestors, info)
+	if w.visit != nil {
+		w.visit(dir, depth, dev)
+	}
+
+	// whatever could be read is still searched when there is an error
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "warning:", err.Error())
+	}
+	for _, entry := range entries {
+		if w.ctx.Err() != nil {
+			return false
+		}
+		if hidden(entry.Name()) {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+
+		info, err := entry.Info()
+		if err == nil && entry.Type()&os.ModeSymlink != 0 {
+			if !opts.FollowSymlinks {
+				continue
+			}
+			info, err = os.Stat(path)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "warning:", err.Error())
+			continue
+		}
+
+		// devices, FIFOs and sockets found in directories are always skipped
+		// as a FIFO with no writer would block the search forever
+		switch {
+		case info.IsDir():
+			if opts.OneFileSystem {
+				if d, ok := deviceID(info); ok && d != dev {
+					continue
+				}
+			}
+			if !w.walk(path, info, depth+1, dev, ancestors) {
+				return false
+			}
+		case info.Mode().IsRegular():
+			if wantFile(path) && !tooBig(info) && !w.found(path, info) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// hidden reports whether the file or directory name is left out of searches
+// for starting with a dot
+func hidden(name string) bool {
+	return !opts.Hidden && strings.HasPrefix(name, ".")
+}
+
+// isDevice reports whether the file is a device, FIFO or socket
+func isDevice(info os.FileInfo) bool {
+	return info.Mode()&(os.ModeDevice|os.ModeNamedPipe|os.ModeSocket) != 0
+}
+
+// tooBig reports whether the file is skipped by --max-filesize
+func tooBig(info os.FileInfo) bool {
+	return opts.MaxFilesize > 0 && info.Mode().IsRegular() && info.Size() > opts.MaxFilesize
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"grep/grep"
+)
+
+const (
+	// watchSettle is how long a burst of changes is given to finish before
+	// the changed files are searched again
+	watchSettle = 100 * time.Millisecond
+
+	watchMask = syscall.IN_CLOSE_WRITE | syscall.IN_MODIFY | syscall.IN_MOVED_TO | syscall.IN_CREATE
+)
+
+// watcher re-runs the search on files as they change, using inotify
+type watcher struct {
+	file *os.File
+	// dirs maps watch descriptors to the directory they watch
+	dirs map[int32]string
+	// recursive holds the watched directories whose files are searched, and
+	// files the files searched in directories that are only watched for
+	// their sake
+	recursive map[string]watchedDir
+	files     map[string]bool
+}
+
+// watchedDir is a directory watched with --recursive. depth and dev are
+// where it was found, for --max-depth and --one-file-system.
+type watchedDir struct {
+	depth int
+	dev   uint64
+}
+
+// watchFiles watches paths, and with --recursive the directories under any
+// of them that are directories, and searches each file again after it
+// changes. It only returns on error, when there is nothing to watch, or once
+// ctx is done.
+func watchFiles(ctx context.Context, searcher *grep.Searcher, paths []string) error {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return err
+	}
+	w := &watcher{
+		file:      os.NewFile(uintptr(fd), "inotify"),
+		dirs:      map[int32]string{},
+		recursive: map[string]watchedDir{},
+		files:     map[string]bool{},
+	}
+	defer w.file.Close()
+	// closing the file also wakes up a read waiting for events
+	defer context.AfterFunc(ctx, func() { w.file.Close() })()
+
+	for _, path := range paths {
+		path = filepath.Clean(path)
+		info, err := os.Stat(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "warning:", err.Error())
+			continue
+		}
+		if info.IsDir() {
+			// only a directory that was searched through is watched
+			if opts.Recursive {
+				dev, _ := deviceID(info)
+				w.addTree(ctx, path, info, 0, dev)
+			} else {
+				fmt.Fprintln(os.Stderr, "warning:", path+": not watched without --recursive")
+			}
+			continue
+		}
+		// editors often replace a file rather than write to it, so the
+		// directory is watched instead of the file itself
+		if err := w.add(filepath.Dir(path)); err != nil {
+			fmt.Fprintln(os.Stderr, "warning:", err.Error())
+			continue
+		}
+		w.files[path] = true
+	}
+	if len(w.dirs) == 0 {
+		return errors.New("--watch has nothing to watch")
+	}
+
+	buf := make([]byte, 64*1024)
+	for {
+		changed := map[string]bool{}
+		n, err := w.file.Read(buf)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			return err
+		}
+		w.parse(ctx, buf[:n], changed)
+
+		for {
+			w.file.SetReadDeadline(time.Now().Add(watchSettle))
+			n, err := w.file.Read(buf)
+			if err != nil {
+				break
+			}
+			w.parse(ctx, buf[:n], changed)
+		}
+		w.file.SetReadDeadline(time.Time{})
+
+		if len(changed) > 0 {
+			w.refresh(ctx, searcher, changed)
+		}
+	}
+}
+
+func (w *watcher) add(dir string) error {
+	wd, err := syscall.InotifyAddWatch(int(w.file.Fd()), dir, watchMask)
+	if err != nil {
+		return fmt.Errorf("%s: %s", dir, err.Error())
+	}
+	w.dirs[int32(wd)] = dir
+	return nil
+}
+
+// addTree watches dir, depth directories below a root on the device dev,
+// and the directories below it that a search with --recursive looks through
+func (w *watcher) addTree(ctx context.Context, dir string, info os.FileInfo, depth int, dev uint64) {
+	wk := &walker{ctx: ctx, found: func(string, os.FileInfo) bool { return true }, visit: func(dir string, depth int, dev uint64) {
+		if err := w.add(dir); err != nil {
+			fmt.Fprintln(os.Stderr, "warning:", err.Error())
+			return
+		}
+		w.recursive[dir] = watchedDir{depth: depth, dev: dev}
+	}}
+	wk.walk(dir, info, depth, dev, nil)
+}
+
+// parse adds the searched files named in the inotify events in buf to
+// changed, and starts watching any directory created in a recursive one
+func (w *watcher) parse(ctx context.Context, buf []byte, changed map[string]bool) {
+	for len(buf) >= syscall.SizeofInotifyEvent {
+		ev := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[0]))
+		nameEnd := syscall.SizeofInotifyEvent + int(ev.Len)
+		name := string(trimNUL(buf[syscall.SizeofInotifyEvent:nameEnd]))
+		buf = buf[nameEnd:]
+
+		dir, ok := w.dirs[ev.Wd]
+		if !ok || name == "" {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		parent, recursive := w.recursive[dir]
+		switch {
+		case ev.Mask&syscall.IN_ISDIR != 0:
+			if recursive && !hidden(name) && ev.Mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 {
+				w.addDir(ctx, path, parent)
+			}
+		case recursive && !hidden(name) && wantFile(path), w.files[path]:
+			changed[path] = true
+		}
+	}
+}
+
+// addDir starts watching the directory path created in parent, unless a
+// search with --recursive would leave it out
+func (w *watcher) addDir(ctx context.Context, path string, parent watchedDir) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	if opts.OneFileSystem {
+		if d, ok := deviceID(info); ok && d != parent.dev {
+			return
+		}
+	}
+	w.addTree(ctx, path, info, parent.depth+1, parent.dev)
+}
+
+// refresh searches the changed files again under a separator
+func (w *watcher) refresh(ctx context.Context, searcher *grep.Searcher, changed map[string]bool) {
+	var paths []string
+	for path := range changed {
+		// a FIFO would block the refresh until something writes to it
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() && !tooBig(info) {
+			paths = append(paths, path)
+		}
+	}
+	if len(paths) == 0 {
+		return
+	}
+	sort.Strings(paths)
+
+	printSync.Lock()
+	fmt.Fprintf(stdout, "=== %s: %d changed ===\n", time.Now().Format("2006-01-02 15:04:05"), len(paths))
+	printSync.Unlock()
+
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			// removed again before it could be searched
+			continue
+		}
+		processFile(ctx, file, searcher)
+	}
+}
+
+func trimNUL(b []byte) []byte {
+	for len(b) > 0 && b[len(b)-1] == 0 {
+		b = b[:len(b)-1]
+	}
+	return b
+}
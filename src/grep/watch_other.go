@@ -0,0 +1,16 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"context"
+	"errors"
+
+	"grep/grep"
+)
+
+// watchFiles needs inotify, which only Linux has
+func watchFiles(ctx context.Context, searcher *grep.Searcher, paths []string) error {
+	return errors.New("--watch is only supported on Linux")
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"grep/grep"
+)
+
+// diffContext is the number of unchanged lines shown around each hunk
+const diffContext = 3
+
+// rewriteFile applies the --replace template to every line of file that the
+// search matches. The new contents replace the file atomically, or with
+// --dry-run are only shown as a unified diff.
+func rewriteFile(ctx context.Context, file *os.File, searcher *grep.Searcher) error {
+	if file == stdin {
+		return errors.New("cannot rewrite standard input")
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return errors.New("not a regular file")
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return err
+	}
+
+	// the search decides which lines are rewritten so that terms and
+	// --all-match are kept to
+	matched := map[int]bool{}
+	err = searcher.Search(ctx, bytes.NewReader(data), file.Name(), func(m *grep.Match) error {
+		matched[m.Line.Num] = true
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var oldLines, newLines []string
+	var out bytes.Buffer
+	changed := false
+	for len(data) > 0 {
+		end := len(data)
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			end = i + 1
+		}
+		line := strings.TrimSuffix(strings.TrimSuffix(string(data[:end]), "\n"), "\r")
+		eol := data[len(line):end]
+
+		repl := line
+		if matched[len(oldLines)+1] {
+			repl = replacer.ReplaceAllString(line, opts.Replace)
+		}
+		changed = changed || repl != line
+		oldLines = append(oldLines, line)
+		newLines = append(newLines, repl)
+
+		out.WriteString(repl)
+		out.Write(eol)
+		data = data[end:]
+	}
+	if !changed {
+		return nil
+	}
+
+	if opts.DryRun {
+		diff := unifiedDiff(file.Name(), oldLines, newLines)
+		printSync.Lock()
+		fmt.Fprint(stdout, diff)
+		printSync.Unlock()
+		return nil
+	}
+	return writeAtomic(file.Name(), info.Mode().Perm(), out.Bytes())
+}
+
+// writeAtomic replaces the file at name with data by writing a temporary
+// file next to it and renaming it into place, so readers never see a
+// partially written file. A symbolic link is left in place and the file it
+// points to is replaced.
+func writeAtomic(name string, perm os.FileMode, data []byte) (err error) {
+	if real, err := filepath.EvalSymlinks(name); err == nil {
+		name = real
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	if opts.Backup != "" {
+		if err = backupFile(name, name+opts.Backup); err != nil {
+			return err
+		}
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+// backupFile keeps the current contents of name at backup. A hard link is
+// enough because the original is replaced by a rename, not rewritten.
+func backupFile(name, backup string) error {
+	os.Remove(backup)
+	if err := os.Link(name, backup); err == nil {
+		return nil
+	}
+
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	dst, err := os.OpenFile(backup, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+// unifiedDiff renders the change from oldLines to newLines. Replacement works
+// line by line, so newLines[i] is what became of oldLines[i] and may itself
+// span several lines if the replacement inserted newlines.
+func unifiedDiff(name string, oldLines, newLines []string) string {
+	var changes []int
+	for i := range oldLines {
+		if oldLines[i] != newLines[i] {
+			changes = append(changes, i)
+		}
+	}
+
+	out := fmt.Sprintf("--- a/%s\n+++ b/%s\n", name, name)
+	// shift is how many more lines the new file has before the current hunk
+	shift := 0
+	for len(changes) > 0 {
+		// a hunk takes every change close enough to share context
+		n := 1
+		for n < len(changes) && changes[n]-changes[n-1] <= 2*diffContext+1 {
+			n++
+		}
+		start := changes[0] - diffContext
+		if start < 0 {
+			start = 0
+		}
+		end := changes[n-1] + diffContext + 1
+		if end > len(oldLines) {
+			end = len(oldLines)
+		}
+
+		var body string
+		newCount := 0
+		for i := start; i < end; i++ {
+			if oldLines[i] == newLines[i] {
+				body += " " + oldLines[i] + "\n"
+				newCount++
+				continue
+			}
+			body += "-" + oldLines[i] + "\n"
+			for _, l := range strings.Split(newLines[i], "\n") {
+				body += "+" + l + "\n"
+				newCount++
+			}
+		}
+		out += fmt.Sprintf("@@ -%d,%d +%d,%d @@\n", start+1, end-start, start+shift+1, newCount) + body
+
+		shift += newCount - (end - start)
+		changes = changes[n:]
+	}
+	return out
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+)
+
+// numbered returns the lines "1" to "n"
+func numbered(n int) []string {
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = strconv.Itoa(i + 1)
+	}
+	return lines
+}
+
+// changed returns numbered(n) with the lines at the indexes in repl replaced
+func changed(n int, repl map[int]string) []string {
+	lines := numbered(n)
+	for i, l := range repl {
+		lines[i] = l
+	}
+	return lines
+}
+
+var unifiedDiffTests = []struct {
+	name     string
+	old, new []string
+	diff     string
+}{
+	{
+		"no change",
+		numbered(3), numbered(3),
+		"--- a/f\n+++ b/f\n",
+	},
+	{
+		"one change",
+		numbered(10), changed(10, map[int]string{4: "five"}),
+		"--- a/f\n+++ b/f\n" +
+			"@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n",
+	},
+	{
+		"first and last lines",
+		numbered(10), changed(10, map[int]string{0: "one", 9: "ten"}),
+		"--- a/f\n+++ b/f\n" +
+			"@@ -1,4 +1,4 @@\n-1\n+one\n 2\n 3\n 4\n" +
+			"@@ -7,4 +7,4 @@\n 7\n 8\n 9\n-10\n+ten\n",
+	},
+	{
+		"changes sharing context",
+		numbered(10), changed(10, map[int]string{1: "two", 8: "nine"}),
+		"--- a/f\n+++ b/f\n" +
+			"@@ -1,10 +1,10 @@\n 1\n-2\n+two\n 3\n 4\n 5\n 6\n 7\n 8\n-9\n+nine\n 10\n",
+	},
+	{
+		"adjacent changes",
+		numbered(3), changed(3, map[int]string{0: "one", 1: "two"}),
+		"--- a/f\n+++ b/f\n" +
+			"@@ -1,3 +1,3 @@\n-1\n+one\n-2\n+two\n 3\n",
+	},
+	{
+		"inserted newline",
+		numbered(12), changed(12, map[int]string{1: "2a\n2b", 11: "twelve"}),
+		"--- a/f\n+++ b/f\n" +
+			"@@ -1,5 +1,6 @@\n 1\n-2\n+2a\n+2b\n 3\n 4\n 5\n" +
+			"@@ -9,4 +10,4 @@\n 9\n 10\n 11\n-12\n+twelve\n",
+	},
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	for _, tt := range unifiedDiffTests {
+		if diff := unifiedDiff("f", tt.old, tt.new); diff != tt.diff {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.name, diff, tt.diff)
+		}
+	}
+}